@@ -1,5 +1,7 @@
 package tgo
 
+import "fmt"
+
 // Action represents an action instruction for the TGO host.
 type Action struct {
 	Type string         `json:"action"`
@@ -20,23 +22,18 @@ func (a *Action) Then(next *Action) *Action {
 	return a
 }
 
+// ToMap returns the action as sent to the host. Actions without data, such
+// as Refresh, have no "data" key rather than a null one, as when Action is
+// marshaled directly. Chained actions become a single "batch" action.
 func (a *Action) ToMap() map[string]any {
 	if a.next == nil {
-		return map[string]any{
-			"action": a.Type,
-			"data":   a.Data,
-		}
+		return a.entry()
 	}
 
 	// Chained actions, convert to batch
-	actions := []map[string]any{
-		{"action": a.Type, "data": a.Data},
-	}
+	actions := []map[string]any{a.entry()}
 	for curr := a.next; curr != nil; curr = curr.next {
-		actions = append(actions, map[string]any{
-			"action": curr.Type,
-			"data":   curr.Data,
-		})
+		actions = append(actions, curr.entry())
 	}
 
 	return map[string]any{
@@ -47,6 +44,15 @@ func (a *Action) ToMap() map[string]any {
 	}
 }
 
+// entry returns a alone, ignoring chained actions.
+func (a *Action) entry() map[string]any {
+	m := map[string]any{"action": a.Type}
+	if len(a.Data) > 0 {
+		m["data"] = a.Data
+	}
+	return m
+}
+
 // OpenURL opens a URL in the user's browser.
 func OpenURL(url, target string) *Action {
 	return &Action{
@@ -56,6 +62,8 @@ func OpenURL(url, target string) *Action {
 }
 
 // InsertText inserts text into the agent's input field.
+//
+// Deprecated: Use InsertTextAt instead.
 func InsertText(text string, replace bool) *Action {
 	return &Action{
 		Type: "insert_text",
@@ -63,6 +71,21 @@ func InsertText(text string, replace bool) *Action {
 	}
 }
 
+// InsertTextAt inserts text into the agent's input field. mode is one of
+// cursor, append, prepend or replace. With selectAfter the inserted text is
+// selected for quick editing.
+func InsertTextAt(text, mode string, selectAfter bool) *Action {
+	return &Action{
+		Type: "insert_text",
+		Data: map[string]any{
+			"text":         text,
+			"mode":         mode,
+			"replace":      mode == "replace", // For hosts that predate mode
+			"select_after": selectAfter,
+		},
+	}
+}
+
 // SendMessage sends a message to the visitor.
 func SendMessage(content, contentType string) *Action {
 	return &Action{
@@ -71,6 +94,15 @@ func SendMessage(content, contentType string) *Action {
 	}
 }
 
+// SendChannelMessage sends content to the external user to on a channel
+// integration, e.g. a reply to a message received via ChannelMessageHandler.
+func SendChannelMessage(channelID, to, content string) *Action {
+	return &Action{
+		Type: "send_channel_message",
+		Data: map[string]any{"channel_id": channelID, "to": to, "content": content},
+	}
+}
+
 // ShowToast displays a notification toast.
 func ShowToast(message, tp string) *Action {
 	return &Action{
@@ -87,9 +119,57 @@ func CopyText(text, toast string) *Action {
 	}
 }
 
-// ShowModal shows a modal with UI template.
+// CreateNote leaves an internal note on the visitor, visible to agents only.
+func CreateNote(visitorID, text string) *Action {
+	return &Action{
+		Type: "create_note",
+		Data: map[string]any{"visitor_id": visitorID, "text": text},
+	}
+}
+
+// TagVisitor adds tags to the visitor.
+func TagVisitor(visitorID string, tags ...string) *Action {
+	return &Action{
+		Type: "tag_visitor",
+		Data: map[string]any{"visitor_id": visitorID, "tags": tags},
+	}
+}
+
+// Notify shows a desktop or in-app notification to the agent, e.g. chained
+// after CreateNote. The host receives
+//
+//	{"action": "notify", "data": {"title": ..., "body": ..., "level": ..., "sound": ..., "action_id": ...}}
+//
+// where level defaults to "info" and sound and action_id are only present when set.
+func Notify(title, body string, opts ...NotifyOption) *Action {
+	data := map[string]any{"title": title, "body": body, "level": "info"}
+	for _, opt := range opts {
+		opt(data)
+	}
+	return &Action{Type: "notify", Data: data}
+}
+
+type NotifyOption func(map[string]any)
+
+// NotifySound plays a sound with the notification, "default" for the host's sound.
+func NotifySound(sound string) NotifyOption {
+	return func(m map[string]any) { m["sound"] = sound }
+}
+
+// NotifyLevel sets the severity: info, success, warning, error.
+func NotifyLevel(level string) NotifyOption {
+	return func(m map[string]any) { m["level"] = level }
+}
+
+// NotifyAction makes clicking the notification send an event with actionID.
+func NotifyAction(actionID string) NotifyOption {
+	return func(m map[string]any) { m["action_id"] = actionID }
+}
+
+// ShowModal shows a modal with UI template. If t is nil or not a template,
+// e.g. an *Action, the modal shows an error text instead of broken content.
 func ShowModal(title string, t Template) *Action {
-	m := t.ToMap()
+	m := templateMap(t)
 	data := map[string]any{
 		"title":    title,
 		"template": m["template"],
@@ -101,6 +181,66 @@ func ShowModal(title string, t Template) *Action {
 	}
 }
 
+// OpenModalLazy opens an empty modal in a loading state and lets the plugin
+// fill it. Right after opening, the host sends an event to the same handler
+// that returned this action (e.g. OnVisitorPanelEvent) with EventType
+// "modal_open" and ActionID fetchActionID. The handler answers with
+// ShowModal, whose content replaces the loading modal instead of opening a
+// second one.
+func OpenModalLazy(title, fetchActionID string) *Action {
+	return &Action{
+		Type: "open_modal",
+		Data: map[string]any{"title": title, "fetch_action_id": fetchActionID},
+	}
+}
+
+// UpdateRegion replaces the content of a lazily loaded region, such as a tab
+// added with Tabs.AddLazyTab, identified by regionID.
+func UpdateRegion(regionID string, t Template) *Action {
+	m := templateMap(t)
+	return &Action{
+		Type: "update_region",
+		Data: map[string]any{"region": regionID, "template": m["template"], "data": m["data"]},
+	}
+}
+
+// UpdateTable replaces the rows of a server-side paginated table, typically
+// in response to its page_change event.
+func UpdateTable(t *Table) *Action {
+	m := t.ToMap()
+	return &Action{
+		Type: "update_table",
+		Data: map[string]any{"template": m["template"], "data": m["data"]},
+	}
+}
+
+// EmitEvent publishes a custom event, e.g. "ticket_created", to the host.
+// Host automations subscribed to name receive payload and may in turn invoke
+// a plugin's Webhook capability. Plugins that list name in a capability's
+// RefreshOn get that capability re-rendered.
+func EmitEvent(name string, payload map[string]any) *Action {
+	if payload == nil {
+		payload = map[string]any{}
+	}
+	return &Action{
+		Type: "emit_event",
+		Data: map[string]any{"name": name, "payload": payload},
+	}
+}
+
+// templateMap returns t.ToMap(), or an error Text template if t does not
+// produce the {"template": ..., "data": ...} shape of a template.
+func templateMap(t Template) map[string]any {
+	if isNil(t) {
+		return NewText("invalid content: nil template").SetType("error").ToMap()
+	}
+	m := t.ToMap()
+	if name, ok := m["template"].(string); !ok || name == "" {
+		return NewText(fmt.Sprintf("invalid content: %T is not a template", t)).SetType("error").ToMap()
+	}
+	return m
+}
+
 // Refresh re-renders the current plugin UI.
 func Refresh() *Action {
 	return &Action{Type: "refresh"}
@@ -111,6 +251,51 @@ func CloseModal() *Action {
 	return &Action{Type: "close_modal"}
 }
 
+// CloseSidebar closes the sidebar opened by a SidebarIframe capability.
+func CloseSidebar() *Action {
+	return &Action{Type: "close_sidebar"}
+}
+
+// ResizeSidebar sets the width of the open sidebar in pixels.
+func ResizeSidebar(width int) *Action {
+	return &Action{
+		Type: "resize_sidebar",
+		Data: map[string]any{"width": width},
+	}
+}
+
+// ScrollToMessage scrolls the agent's conversation view to the message with
+// ID messageID, as found in Message.ID, and highlights it briefly. The message
+// must belong to the session the agent has open; otherwise the host shows a
+// "message not found" toast.
+func ScrollToMessage(messageID string) *Action {
+	return &Action{
+		Type: "scroll_to_message",
+		Data: map[string]any{"message_id": messageID},
+	}
+}
+
+// FocusElement scrolls to and focuses an element of the plugin's own UI.
+// elementID is the region of a lazily loaded tab (see Tabs.AddLazyTab) or the
+// name of a field of the open form. Elements outside the plugin's UI cannot
+// be focused.
+func FocusElement(elementID string) *Action {
+	return &Action{
+		Type: "focus_element",
+		Data: map[string]any{"element_id": elementID},
+	}
+}
+
+// SetCapabilityBadge shows count on the tab or icon of the plugin's
+// capability of type capabilityType, e.g. "visitor_panel", such as the
+// number of open tickets. A count of 0 or less clears the badge.
+func SetCapabilityBadge(capabilityType string, count int) *Action {
+	return &Action{
+		Type: "set_badge",
+		Data: map[string]any{"capability_type": capabilityType, "count": max(count, 0)},
+	}
+}
+
 // Noop performs no operation.
 func Noop() *Action {
 	return &Action{Type: "noop"}
@@ -0,0 +1,126 @@
+package tgo_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/tgoai/tgo-plugin-go"
+	"github.com/tgoai/tgo-plugin-go/tgotest"
+)
+
+func TestActionChaining(t *testing.T) {
+	got := tgotest.ToMap(tgo.ResizeSidebar(640).Then(tgo.ShowToast("Expanded", "info")).Then(tgo.CloseSidebar()))
+	want := map[string]any{"action": "batch", "data": map[string]any{"actions": []any{
+		map[string]any{"action": "resize_sidebar", "data": map[string]any{"width": 640.0}},
+		map[string]any{"action": "show_toast", "data": map[string]any{"message": "Expanded", "type": "info", "duration": 3000.0}},
+		map[string]any{"action": "close_sidebar"},
+	}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSingleActions(t *testing.T) {
+	tests := []struct {
+		action *tgo.Action
+		want   map[string]any
+	}{
+		{tgo.CloseSidebar(), map[string]any{"action": "close_sidebar"}},
+		{tgo.ResizeSidebar(320), map[string]any{"action": "resize_sidebar", "data": map[string]any{"width": 320.0}}},
+		{tgo.CloseSidebar().Then(nil), map[string]any{"action": "close_sidebar"}},
+	}
+	for _, tt := range tests {
+		if got := tgotest.ToMap(tt.action); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("got %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func TestEmitEvent(t *testing.T) {
+	payload := map[string]any{
+		"ticket": map[string]any{
+			"id":     "TK-1",
+			"tags":   []string{"bug", "ui"},
+			"fields": map[string]any{"priority": 2, "assignee": nil},
+		},
+		"history": []any{map[string]any{"status": "open"}, []int{1, 2}},
+	}
+	got := tgotest.ToMap(tgo.EmitEvent("ticket_created", payload).Then(tgo.Refresh()))
+	want := map[string]any{"action": "batch", "data": map[string]any{"actions": []any{
+		map[string]any{"action": "emit_event", "data": map[string]any{
+			"name": "ticket_created",
+			"payload": map[string]any{
+				"ticket": map[string]any{
+					"id":     "TK-1",
+					"tags":   []any{"bug", "ui"},
+					"fields": map[string]any{"priority": 2.0, "assignee": nil},
+				},
+				"history": []any{map[string]any{"status": "open"}, []any{1.0, 2.0}},
+			},
+		}},
+		map[string]any{"action": "refresh"},
+	}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got = tgotest.ToMap(tgo.EmitEvent("ping", nil))
+	want = map[string]any{"action": "emit_event", "data": map[string]any{"name": "ping", "payload": map[string]any{}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nil payload: got %v, want %v", got, want)
+	}
+}
+
+// shapeless is a Template whose ToMap lacks the template key.
+type shapeless struct{}
+
+func (shapeless) ToMap() map[string]any { return map[string]any{"foo": "bar"} }
+
+func TestShowModalMalformedTemplate(t *testing.T) {
+	var unset *tgo.Text
+	tests := []struct {
+		name    string
+		content tgo.Template
+	}{
+		{"nil", nil},
+		{"action", tgo.Refresh()},
+		{"shapeless", shapeless{}},
+		{"typed nil", unset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tgotest.ToMap(tgo.ShowModal("Details", tt.content))["data"].(map[string]any)
+			text, _ := data["data"].(map[string]any)
+			if data["title"] != "Details" || data["template"] != "text" || text["type"] != "error" {
+				t.Errorf("got %v, want an error text", data)
+			}
+		})
+	}
+
+	data := tgotest.ToMap(tgo.ShowModal("Details", tgo.NewText("ok")))["data"]
+	want := map[string]any{"title": "Details", "template": "text", "data": map[string]any{"text": "ok"}}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("got %v, want %v", data, want)
+	}
+}
+
+func TestActionsWithoutData(t *testing.T) {
+	for _, action := range []*tgo.Action{tgo.Refresh(), tgo.CloseModal(), tgo.CloseSidebar(), tgo.Noop()} {
+		if m := action.ToMap(); m["data"] != nil || len(m) != 1 {
+			t.Errorf("%s: got %v", action.Type, m)
+		}
+		data, err := json.Marshal(action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"action":"` + action.Type + `"}`; string(data) != want {
+			t.Errorf("%s: marshaled to %s, want %s", action.Type, data, want)
+		}
+	}
+
+	batch, _ := json.Marshal(tgo.Refresh().Then(tgo.CloseModal()).ToMap())
+	if want := `{"action":"batch","data":{"actions":[{"action":"refresh"},{"action":"close_modal"}]}}`; string(batch) != want {
+		t.Errorf("batch: got %s, want %s", batch, want)
+	}
+}
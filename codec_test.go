@@ -0,0 +1,304 @@
+package tgo_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tgoai/tgo-plugin-go"
+)
+
+type codecInner struct {
+	Note string `json:"note,omitempty"`
+	Deep int    `json:"deep"`
+}
+
+type codecEmbedded struct {
+	Promoted string `json:"promoted"`
+	Shadowed string `json:"name"` // Loses to the outer field
+}
+
+type codecStruct struct {
+	codecEmbedded
+	*codecInner
+
+	Name      string `json:"name"`
+	Skipped   string `json:"-"`
+	Empty     string `json:"empty,omitempty"`
+	Untagged  bool
+	Tags      []string          `json:"tags"`
+	Nil       []string          `json:"nil"`
+	Attrs     map[string]any    `json:"attrs"`
+	Counts    map[int]uint16    `json:"counts"`
+	When      time.Time         `json:"when"`
+	Raw       json.RawMessage   `json:"raw"`
+	Marshaler jsonMarshaler     `json:"marshaler"`
+	Text      textMarshaler     `json:"text"`
+	Ptr       *float32          `json:"ptr"`
+	Bytes     []byte            `json:"bytes"`
+	Array     [2]int8           `json:"array"`
+	Iface     any               `json:"iface"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	unexposed int
+}
+
+type jsonMarshaler struct{ v int }
+
+func (m jsonMarshaler) MarshalJSON() ([]byte, error) { return json.Marshal(map[string]int{"v": m.v}) }
+
+type textMarshaler struct{ s string }
+
+func (m textMarshaler) MarshalText() ([]byte, error) { return []byte("text:" + m.s), nil }
+
+// viaJSON returns v as encoding/json decodes it into an any.
+func viaJSON(t *testing.T, v any) any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func viaMsgpack(t *testing.T, v any) any {
+	t.Helper()
+	data, err := tgo.MsgpackCodec.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out any
+	if err := tgo.MsgpackCodec.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	f32 := float32(1.5)
+	long := func(n int) string { return strings.Repeat("x", n) }
+	array := func(n int) []int {
+		a := make([]int, n)
+		for i := range a {
+			a[i] = i
+		}
+		return a
+	}
+	bigMap := func(n int) map[string]bool {
+		m := make(map[string]bool, n)
+		for i := range n {
+			m[fmt.Sprint(i)] = i%2 == 0
+		}
+		return m
+	}
+
+	tests := []struct {
+		name string
+		v    any
+	}{
+		{"nil", nil},
+		{"true", true},
+		{"false", false},
+		{"positive fixint", 127},
+		{"uint8", uint8(200)},
+		{"uint16", 60000},
+		{"uint32", uint32(4000000000)},
+		{"uint64", uint64(1 << 40)},
+		{"negative fixint", -32},
+		{"int8", int8(-100)},
+		{"int16", int16(-30000)},
+		{"int32", int32(-2000000000)},
+		{"int64", int64(-1 << 40)},
+		{"float32", float32(0.25)},
+		{"float64", math.Pi},
+		{"fixstr", "héllo"},
+		{"str8", long(200)},
+		{"str16", long(60000)},
+		{"str32", long(70000)},
+		{"fixarray", []string{"a", "b"}},
+		{"array16", array(1000)},
+		{"array32", array(70000)},
+		{"fixmap", map[string]any{"a": 1, "b": []any{nil, "x"}}},
+		{"map16", bigMap(1000)},
+		{"map32", bigMap(70000)},
+		{"nil slice", []int(nil)},
+		{"nil map", map[string]int(nil)},
+		{"nil pointer", (*codecStruct)(nil)},
+		{"bytes", []byte{0, 1, 2, 255}},
+		{"time", time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)},
+		{"struct", codecStruct{
+			codecEmbedded: codecEmbedded{Promoted: "p", Shadowed: "hidden"},
+			codecInner:    &codecInner{Deep: 3},
+			Name:          "outer",
+			Skipped:       "skipped",
+			Untagged:      true,
+			Tags:          []string{"a"},
+			Attrs:         map[string]any{"nested": map[string]any{"x": 1.5}},
+			Counts:        map[int]uint16{1: 2},
+			When:          time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("X", 3600)),
+			Raw:           json.RawMessage(`{"raw":[1,2]}`),
+			Marshaler:     jsonMarshaler{v: 7},
+			Text:          textMarshaler{s: "t"},
+			Ptr:           &f32,
+			Bytes:         []byte("bin"),
+			Array:         [2]int8{-1, 1},
+			Iface:         []any{1, "two"},
+			unexposed:     1,
+		}},
+		{"struct with nil embedded pointer", codecStruct{Name: "n"}},
+		{"template", tgo.NewTable("t").Columns("a").Row(map[string]any{"a": 1}).ToMap()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, want := viaMsgpack(t, tt.v), viaJSON(t, tt.v)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", abbrev(got), abbrev(want))
+			}
+		})
+	}
+}
+
+func abbrev(v any) string {
+	s := fmt.Sprint(v)
+	if len(s) > 200 {
+		return s[:200] + "..."
+	}
+	return s
+}
+
+func TestMsgpackDecodesBinAsBase64(t *testing.T) {
+	for _, data := range [][]byte{
+		{0xc4, 3, 'b', 'i', 'n'},
+		{0xc5, 0, 3, 'b', 'i', 'n'},
+		{0xc6, 0, 0, 0, 3, 'b', 'i', 'n'},
+	} {
+		var got any
+		if err := tgo.MsgpackCodec.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != "Ymlu" {
+			t.Errorf("bin 0x%02x: got %#v, want base64 string", data[0], got)
+		}
+	}
+}
+
+func TestMsgpackUnmarshalInto(t *testing.T) {
+	data, err := tgo.MsgpackCodec.Marshal(map[string]any{"id": "TK-1", "tags": []string{"a"}, "count": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := tgo.MsgpackCodec.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["count"] != float64(2) {
+		t.Errorf("map: got %v", m)
+	}
+	var s struct {
+		ID    string   `json:"id"`
+		Tags  []string `json:"tags"`
+		Count int      `json:"count"`
+	}
+	if err := tgo.MsgpackCodec.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.ID != "TK-1" || len(s.Tags) != 1 || s.Count != 2 {
+		t.Errorf("struct: got %+v", s)
+	}
+	if err := tgo.MsgpackCodec.Unmarshal([]byte{0x91, 0x01}, &m); err == nil {
+		t.Error("decoding an array into a map succeeded")
+	}
+}
+
+func TestMsgpackInvalid(t *testing.T) {
+	deep := strings.Repeat("\x91", 2000) + "\xc0"
+	for name, data := range map[string][]byte{
+		"empty":         {},
+		"truncated str": {0xa5, 'a'},
+		"truncated map": {0x82, 0xa1, 'a'},
+		"huge array":    {0xdd, 0xff, 0xff, 0xff, 0xff},
+		"trailing data": {0xc0, 0xc0},
+		"unknown":       {0xc1},
+		"ext":           {0xd4, 0x01, 0x00},
+		"too deep":      []byte(deep),
+	} {
+		var v any
+		if err := tgo.MsgpackCodec.Unmarshal(data, &v); err == nil {
+			t.Errorf("%s: decoded %v without error", name, v)
+		}
+	}
+	if _, err := tgo.MsgpackCodec.Marshal(make(chan int)); err == nil {
+		t.Error("marshaling a channel succeeded")
+	}
+}
+
+func TestMsgpackOverTransport(t *testing.T) {
+	a, b := net.Pipe()
+	ta, tb := tgo.NewConnTransport(a), tgo.NewConnTransport(b)
+	defer ta.Close()
+	defer tb.Close()
+	ta.SetCodec(tgo.MsgpackCodec)
+	tb.SetCodec(tgo.MsgpackCodec)
+
+	want := map[string]any{"jsonrpc": "2.0", "id": float64(1), "result": map[string]any{"html": "<a href=\"?a=1&b=2\">"}}
+	go ta.SendMessage(want)
+	got, err := tb.RecvMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+// largeTable is a dashboard-sized table of 5000 rows.
+func largeTable() map[string]any {
+	table := tgo.NewTable("Tickets").Columns("id", "title", "status", "priority", "created_at")
+	for i := range 5000 {
+		table.Row(map[string]any{
+			"id":         fmt.Sprintf("TK-%d", i),
+			"title":      "Cannot log in to the dashboard",
+			"status":     map[string]any{"text": "Open", "color": "orange"},
+			"priority":   i % 4,
+			"created_at": time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		})
+	}
+	return map[string]any{"jsonrpc": "2.0", "id": 1, "result": table.ToMap()}
+}
+
+func BenchmarkCodecLargeTable(b *testing.B) {
+	msg := largeTable()
+	codecs := []struct {
+		name      string
+		marshal   func(any) ([]byte, error)
+		unmarshal func([]byte, any) error
+	}{
+		{"json", json.Marshal, json.Unmarshal},
+		{"msgpack", tgo.MsgpackCodec.Marshal, tgo.MsgpackCodec.Unmarshal},
+	}
+	for _, c := range codecs {
+		b.Run(c.name, func(b *testing.B) {
+			data, _ := c.marshal(msg)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for range b.N {
+				data, err := c.marshal(msg)
+				if err != nil {
+					b.Fatal(err)
+				}
+				var v any
+				if err := c.unmarshal(data, &v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package tgo
+
+import (
+	"slices"
+	"sync"
+)
+
+// capabilityMethods maps request method prefixes to the capability type serving them.
+var capabilityMethods = map[string]string{
+	"visitor_panel":       "visitor_panel",
+	"chat_toolbar":        "chat_toolbar",
+	"dashboard_widget":    "dashboard_widget",
+	"settings":            "settings_page",
+	"webhook":             "webhook",
+	"slash_command":       "slash_command",
+	"task":                "scheduled_task",
+	"reply_templates":     "reply_templates",
+	"sidebar_iframe":      "sidebar_iframe",
+	"channel_integration": "channel_integration",
+	"tool":                "mcp_tools",
+}
+
+// methodCapability returns the capability type serving method, or "" for
+// methods not tied to a capability such as ping.
+func methodCapability(method string) string {
+	for i := 0; i < len(method); i++ {
+		if method[i] == '/' {
+			return capabilityMethods[method[:i]]
+		}
+	}
+	return ""
+}
+
+// enablement tracks the declared capabilities and which of their types are
+// enabled. Types default to enabled unless declared with WithEnabled(false)
+// or disabled by the host. The capabilities are a copy, so handlers never
+// read the plugin's own while it changes them.
+type enablement struct {
+	mu       sync.RWMutex
+	caps     []Capability
+	disabled map[string]bool
+	declared map[string]bool
+}
+
+func newEnablement(caps []Capability) *enablement {
+	e := &enablement{caps: cloneCapabilities(caps), disabled: map[string]bool{}, declared: map[string]bool{}}
+	for _, c := range caps {
+		e.declared[c.Type] = true
+		if c.Enabled != nil && !*c.Enabled {
+			e.disabled[c.Type] = true
+		}
+	}
+	return e
+}
+
+// reset rebuilds the enablement for caps after the capabilities changed at
+// runtime. Types declared before but no longer in caps are disabled.
+func (e *enablement) reset(caps []Capability) {
+	next := newEnablement(caps)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for capType := range e.declared {
+		if !next.declared[capType] {
+			next.disabled[capType] = true
+		}
+	}
+	for capType, off := range e.disabled {
+		if off && !next.declared[capType] {
+			next.disabled[capType] = true // Removed by an earlier update
+		}
+	}
+	e.caps, e.disabled, e.declared = next.caps, next.disabled, next.declared
+}
+
+// tool returns the definition of the declared MCP tool name, or nil.
+func (e *enablement) tool(name string) *MCPToolDefinition {
+	if e == nil {
+		return nil
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, c := range e.caps {
+		for i := range c.Tools {
+			if c.Tools[i].Name == name {
+				return &c.Tools[i]
+			}
+		}
+	}
+	return nil
+}
+
+// cloneCapabilities copies caps deeply enough that later changes by the
+// plugin to the slices it passed do not show.
+func cloneCapabilities(caps []Capability) []Capability {
+	out := slices.Clone(caps)
+	for i := range out {
+		out[i].Tools = slices.Clone(out[i].Tools)
+	}
+	return out
+}
+
+// update applies a host provided map of capability type to enabled flag.
+func (e *enablement) update(m map[string]any) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for capType, v := range m {
+		if on, ok := v.(bool); ok {
+			e.disabled[capType] = !on
+		}
+	}
+}
+
+func (e *enablement) enabled(capType string) bool {
+	if e == nil || capType == "" {
+		return true
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return !e.disabled[capType]
+}
@@ -0,0 +1,94 @@
+package tgo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	// ErrNotConnected is returned when using a Transport without a connection.
+	ErrNotConnected = errors.New("not connected")
+	// ErrConnectionClosed is returned by Call when the connection is lost.
+	ErrConnectionClosed = errors.New("connection closed")
+	// ErrRegistrationRejected is returned by Run when the host refuses to register the plugin.
+	ErrRegistrationRejected = errors.New("rejected by host")
+	// ErrUnsupportedProtocol is returned by Run when the host's protocol version is below Options.MinProtocolVersion.
+	ErrUnsupportedProtocol = errors.New("unsupported protocol version")
+	// ErrInvalidMessage is wrapped by the errors of RecvMessage and Serve when a
+	// frame cannot be decompressed or decoded into a JSON-RPC message.
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+// JSON-RPC error codes used by the SDK.
+const (
+	CodeServerBusy     = -32000
+	CodeDisabled       = -32001 // The capability serving the method is disabled
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// TransportError is an I/O failure of the Transport. Op describes what was
+// attempted and Err is the underlying cause, e.g. io.EOF.
+type TransportError struct {
+	Op  string
+	Err error
+}
+
+func (e *TransportError) Error() string { return fmt.Sprintf("failed to %s: %v", e.Op, e.Err) }
+func (e *TransportError) Unwrap() error { return e.Err }
+
+// Timeout reports whether the failure was a read or write timeout, see
+// WithReadTimeout and WithWriteTimeout. The connection should be considered
+// dead and re-established.
+func (e *TransportError) Timeout() bool { return errors.Is(e.Err, os.ErrDeadlineExceeded) }
+
+// RPCError is a JSON-RPC error. Handlers may return it to control the error
+// code sent to the host, other errors are sent as CodeInternalError.
+// HostClient calls return it when the host replies with an error.
+type RPCError struct {
+	Code    int
+	Message string
+}
+
+func (e *RPCError) Error() string { return e.Message }
+
+// RetryableError marks a tool handler error as transient. Tools declared with
+// ToolBuilder.WithRetry are executed again only when the returned error wraps it.
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string { return e.Err.Error() }
+func (e *RetryableError) Unwrap() error { return e.Err }
+
+// Retryable wraps err in a RetryableError. It returns nil if err is nil.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+func errNotImplemented(method string) error {
+	return &RPCError{Code: CodeMethodNotFound, Message: fmt.Sprintf("method not implemented: %s", method)}
+}
+
+// responseError extracts the error of a JSON-RPC response, if any.
+func responseError(resp map[string]any) error {
+	e, ok := resp["error"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	rerr := &RPCError{}
+	switch code := e["code"].(type) {
+	case int:
+		rerr.Code = code
+	case float64:
+		rerr.Code = int(code)
+	}
+	rerr.Message, _ = e["message"].(string)
+	return rerr
+}
@@ -22,71 +22,88 @@ func (p *CRMPlugin) Capabilities() []tgo.Capability {
 	}
 }
 
-func (p *CRMPlugin) OnVisitorPanelRender(ctx *tgo.RenderContext) tgo.Template {
-	title := "客户信息"
-	if ctx.Language == "en" {
-		title = "Customer Info"
-	}
+var translations = tgo.NewBundle("zh", map[string]map[string]string{
+	"zh": {
+		"title":          "客户信息",
+		"unknown":        "未知访客",
+		"tip":            "提示",
+		"no_visitor":     "无法获取访客信息",
+		"name":           "姓名",
+		"level":          "等级",
+		"platinum":       "铂金会员",
+		"recent_orders":  "最近订单",
+		"order_id":       "订单号",
+		"amount":         "金额",
+		"status":         "状态",
+		"shipping":       "配送中",
+		"completed":      "已完成",
+		"view_crm":       "查看 CRM 详情",
+		"send_coupon":    "发送优惠券",
+		"coupon_sent":    "优惠券已发送给访客",
+		"event_received": "收到事件: %s",
+	},
+	"en": {
+		"title":          "Customer Info",
+		"unknown":        "Unknown Visitor",
+		"tip":            "Tip",
+		"no_visitor":     "Unable to get visitor info",
+		"name":           "Name",
+		"level":          "Level",
+		"platinum":       "Platinum",
+		"recent_orders":  "Recent Orders",
+		"order_id":       "Order ID",
+		"amount":         "Amount",
+		"status":         "Status",
+		"shipping":       "Shipping",
+		"completed":      "Completed",
+		"view_crm":       "View CRM Details",
+		"send_coupon":    "Send Coupon",
+		"coupon_sent":    "Coupon sent to visitor",
+		"event_received": "Event received: %s",
+	},
+})
 
+func (p *CRMPlugin) OnVisitorPanelRender(ctx *tgo.RenderContext) tgo.Template {
 	if ctx.Visitor == nil {
-		if ctx.Language == "en" {
-			return tgo.NewKeyValue("Unknown Visitor").Add("Tip", "Unable to get visitor info")
-		}
-		return tgo.NewKeyValue("未知访客").Add("提示", "无法获取访客信息")
+		return tgo.NewKeyValue(ctx.T("unknown")).Add(ctx.T("tip"), ctx.T("no_visitor"))
 	}
 
 	// Build UI
 	group := tgo.NewGroup()
 
-	// 1. Basic Info
-	idLabel, nameLabel, levelLabel := "ID", "姓名", "等级"
-	levelValue := "铂金会员"
-	if ctx.Language == "en" {
-		nameLabel, levelLabel = "Name", "Level"
-		levelValue = "Platinum"
-	}
+	// 1. Header and Basic Info
+	group.Add(tgo.NewAvatar(ctx.Visitor.Name).
+		SetImage(ctx.Visitor.Avatar).
+		SetSubtitle(ctx.Visitor.Email))
 
-	info := tgo.NewKeyValue(title).
-		Add(idLabel, ctx.VisitorID, tgo.KeyValueCopyable(true)).
-		Add(nameLabel, ctx.Visitor.Name).
-		Add(levelLabel, levelValue, tgo.KeyValueIcon("crown"), tgo.KeyValueColor("#FFD700"))
+	info := tgo.NewKeyValue(ctx.T("title")).
+		Add("ID", ctx.VisitorID, tgo.KeyValueCopyable(true)).
+		Add("CRM ID", "CRM-"+ctx.VisitorID, tgo.KeyValueLink("https://crm.example.com/visitor/"+ctx.VisitorID)).
+		Add(ctx.T("name"), ctx.Visitor.Name).
+		Add(ctx.T("level"), ctx.T("platinum"), tgo.KeyValueIcon("crown"), tgo.KeyValueColor("#FFD700"))
 	group.Add(info)
 
 	// 2. Orders Table
-	orderTitle := "最近订单"
-	orderCol, amountCol, statusCol := "订单号", "金额", "状态"
-	statusText := "配送中"
-	statusDone := "已完成"
-	if ctx.Language == "en" {
-		orderTitle = "Recent Orders"
-		orderCol, amountCol, statusCol = "Order ID", "Amount", "Status"
-		statusText = "Shipping"
-		statusDone = "Completed"
-	}
-
-	table := tgo.NewTable(orderTitle).
-		Columns(orderCol, amountCol, statusCol).
+	orderCol, amountCol, statusCol := ctx.T("order_id"), ctx.T("amount"), ctx.T("status")
+	table := tgo.NewTable(ctx.T("recent_orders")).
+		Columns(orderCol, tgo.Column(amountCol, amountCol, tgo.ColumnAlign("right"), tgo.ColumnSortable(true)), statusCol).
+		PageSize(10).
 		Row(map[string]any{
 			orderCol:  "GO-001",
 			amountCol: "¥1,299",
-			statusCol: map[string]any{"text": statusText, "color": "blue"},
+			statusCol: map[string]any{"text": ctx.T("shipping"), "color": "blue"},
 		}).
 		Row(map[string]any{
 			orderCol:  "GO-002",
 			amountCol: "¥88",
-			statusCol: map[string]any{"text": statusDone, "color": "green"},
+			statusCol: map[string]any{"text": ctx.T("completed"), "color": "green"},
 		})
 	group.Add(table)
 
 	// 3. Actions
-	viewBtn, sendBtn := "查看 CRM 详情", "发送优惠券"
-	if ctx.Language == "en" {
-		viewBtn, sendBtn = "View CRM Details", "Send Coupon"
-	}
-
-	actions := tgo.NewGroup().SetHorizontal().
-		Add(tgo.NewButton(viewBtn, "view_crm").SetIcon("external-link")).
-		Add(tgo.NewButton(sendBtn, "send_coupon").SetType("secondary").SetIcon("ticket"))
+	actions := tgo.NewGroup().SetHorizontal().SetGap(8).SetAlign("center").
+		Add(tgo.NewButton(ctx.T("view_crm"), "view_crm").SetIcon("external-link")).
+		Add(tgo.NewButton(ctx.T("send_coupon"), "send_coupon").SetType("secondary").SetIcon("ticket"))
 	group.Add(actions)
 
 	return group
@@ -97,9 +114,9 @@ func (p *CRMPlugin) OnVisitorPanelEvent(ctx *tgo.EventContext) *tgo.Action {
 		return tgo.OpenURL(fmt.Sprintf("https://crm.example.com/visitor/%s", ctx.VisitorID), "_blank")
 	}
 	if ctx.ActionID == "send_coupon" {
-		return tgo.ShowToast("优惠券已发送给访客", "success")
+		return tgo.ShowToast(ctx.T("coupon_sent"), "success")
 	}
-	return tgo.ShowToast("收到事件: "+ctx.EventType, "info")
+	return tgo.ShowToast(ctx.T("event_received", ctx.EventType), "info")
 }
 
 func (p *CRMPlugin) OnChatToolbarEvent(ctx *tgo.EventContext) *tgo.Action {
@@ -120,7 +137,7 @@ func main() {
 	plugin := &CRMPlugin{}
 	// On macOS, Unix socket bind mounts from Docker are not accessible from host.
 	// Use TCP port 8005 for local debugging.
-	if err := tgo.Run(plugin); err != nil {
+	if err := tgo.Run(plugin, tgo.WithI18n(translations)); err != nil {
 		log.Fatalf("Plugin exited: %v", err)
 	}
 }
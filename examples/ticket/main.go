@@ -17,12 +17,28 @@ type Ticket struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-// Mock database
-var mockTickets = map[string][]Ticket{
+// Mock database, shared by concurrently running handlers
+var mockTickets = tgo.NewSafeStore(map[string][]Ticket{
 	"visitor_1": {
 		{ID: "TK-1001", Title: "无法登录后台", Status: "Open", Priority: "High", CreatedAt: time.Now().Add(-24 * time.Hour)},
 		{ID: "TK-1002", Title: "建议增加深色模式", Status: "Closed", Priority: "Low", CreatedAt: time.Now().Add(-72 * time.Hour)},
 	},
+})
+
+// addTicket creates an open ticket for the visitor and returns its ID.
+func addTicket(visitorID, title, priority string) string {
+	var newID string
+	mockTickets.Update(visitorID, func(tickets []Ticket) []Ticket {
+		newID = fmt.Sprintf("TK-%d", 1000+len(tickets)+1)
+		return append(tickets, Ticket{
+			ID:        newID,
+			Title:     title,
+			Status:    "Open",
+			Priority:  priority,
+			CreatedAt: time.Now(),
+		})
+	})
+	return newID
 }
 
 type TicketPlugin struct {
@@ -47,7 +63,12 @@ func (p *TicketPlugin) Capabilities() []tgo.Capability {
 				Description("根据访客对话内容创建一个新的服务工单。").
 				String("title", "工单标题", true).
 				String("description", "详细描述", true).
-				Enum("priority", "优先级", []string{"low", "medium", "high", "urgent"}, false),
+				EnumWithLabels("priority", "优先级", []tgo.EnumOption{
+					{Value: "low", Label: "低"},
+					{Value: "medium", Label: "中"},
+					{Value: "high", Label: "高"},
+					{Value: "urgent", Label: "紧急", Description: "影响业务的严重问题"},
+				}, false, tgo.ParamDefault("medium")),
 			tgo.Tool("list_tickets", "列出访客工单").
 				Description("获取指定访客的所有历史工单列表。"),
 		),
@@ -62,7 +83,7 @@ func (p *TicketPlugin) OnVisitorPanelRender(ctx *tgo.RenderContext) tgo.Template
 		return tgo.NewText("请选择一个访客以查看工单信息。")
 	}
 
-	tickets := mockTickets[visitorID]
+	tickets, _ := mockTickets.Get(visitorID)
 
 	group := tgo.NewGroup()
 
@@ -72,10 +93,9 @@ func (p *TicketPlugin) OnVisitorPanelRender(ctx *tgo.RenderContext) tgo.Template
 		Add(tgo.NewButton("手动创建", "open_create_form").SetIcon("plus").SetType("primary").SetSize("sm"))
 	group.Add(header)
 
-	if len(tickets) == 0 {
-		group.Add(tgo.NewText("该访客暂无工单记录。").SetColor("#999"))
-	} else {
-		table := tgo.NewTable("").Columns("ID", "标题", "状态", "优先级")
+	group.Add(tgo.When(len(tickets) == 0, tgo.NewText("该访客暂无工单记录。").SetColor("#999")))
+	if len(tickets) > 0 {
+		table := tgo.NewTable("").Columns("ID", "标题", "状态", "优先级").RowAction("view_ticket").RowKey("ID")
 		for _, t := range tickets {
 			statusColor := "blue"
 			if t.Status == "Closed" {
@@ -102,20 +122,50 @@ func (p *TicketPlugin) OnVisitorPanelRender(ctx *tgo.RenderContext) tgo.Template
 func (p *TicketPlugin) OnChatToolbarRender(ctx *tgo.RenderContext) tgo.Template {
 	// Directly return the create form when the toolbar entry is clicked (if supported by host)
 	// or return a button that triggers the form.
-	return tgo.NewForm("新建工单").
-		Add(tgo.NewFormField("title", "工单标题", "text").SetRequired(true).SetPlaceholder("简述问题...")).
-		Add(tgo.NewFormField("priority", "优先级", "select").
-			AddOption("低", "low").
-			AddOption("中", "medium").
-			AddOption("高", "high").
-			SetDefault("medium")).
-		Add(tgo.NewFormField("description", "详细描述", "textarea").SetPlaceholder("请输入详细描述..."))
+	return ticketForm.Clone().SubmitAction(createTicketModal.ActionID())
+}
+
+// createTicketModal routes submissions of the ticket form to createTicket.
+var createTicketModal = tgo.NewFormModal("submit_ticket", "新建工单", ticketForm, createTicket)
+
+func (p *TicketPlugin) FormModals() []*tgo.FormModal {
+	return []*tgo.FormModal{createTicketModal}
+}
+
+// ticketForm is the base ticket form; users Clone it before customizing.
+var ticketForm = tgo.NewForm("新建工单").
+	Add(tgo.NewFormField("title", "工单标题", "text").SetRequired(true).SetPlaceholder("简述问题...")).
+	Add(tgo.NewFormField("priority", "优先级", "select").
+		AddOption("低", "low").
+		AddOption("中", "medium").
+		AddOption("高", "high").
+		SetDefault("medium")).
+	Add(tgo.NewFormField("description", "详细描述", "textarea").SetPlaceholder("请输入详细描述..."))
+
+// CreateTicketRequest holds the fields of ticketForm.
+type CreateTicketRequest struct {
+	Title    string `json:"title"`
+	Priority string `json:"priority"`
+}
+
+func createTicket(ctx *tgo.EventContext) *tgo.Action {
+	var req CreateTicketRequest
+	if err := ctx.BindForm(&req); err != nil {
+		return tgo.ShowToast(err.Error(), "error")
+	}
+
+	// In a real app, you'd save to DB here
+	newID := addTicket(ctx.VisitorID, req.Title, req.Priority)
+
+	return tgo.ShowToast(fmt.Sprintf("工单 %s 创建成功", newID), "success").
+		Then(tgo.CloseModal()).
+		Then(tgo.Refresh())
 }
 
 // --- Event Handling (Buttons/Forms) ---
 
 func (p *TicketPlugin) OnVisitorPanelEvent(ctx *tgo.EventContext) *tgo.Action {
-	fmt.Println("OnVisitorPanelEvent", ctx.EventType, ctx.ActionID, ctx.VisitorID, ctx.SessionID)
+	log.Printf("OnVisitorPanelEvent: %s %s (Visitor: %s, Session: %s)", ctx.EventType, ctx.ActionID, ctx.VisitorID, ctx.SessionID)
 	return p.handleCommonEvents(ctx)
 }
 
@@ -126,36 +176,24 @@ func (p *TicketPlugin) OnChatToolbarEvent(ctx *tgo.EventContext) *tgo.Action {
 func (p *TicketPlugin) handleCommonEvents(ctx *tgo.EventContext) *tgo.Action {
 	switch ctx.ActionID {
 	case "open_create_form", "创建工单":
-		// Show a form to create a ticket
-		form := tgo.NewForm("新建工单").
-			Add(tgo.NewFormField("title", "工单标题", "text").SetRequired(true).SetPlaceholder("简述问题...")).
-			Add(tgo.NewFormField("priority", "优先级", "select").
-				AddOption("低", "low").
-				AddOption("中", "medium").
-				AddOption("高", "high").
-				SetDefault("medium")).
-			Add(tgo.NewFormField("description", "详细描述", "textarea").SetPlaceholder("请输入详细描述..."))
-
-		return tgo.ShowModal("新建工单", form)
-
-	case "submit":
-		// Handle form submission
-		title, _ := ctx.FormData["title"].(string)
-		priority, _ := ctx.FormData["priority"].(string)
-
-		// In a real app, you'd save to DB here
-		newID := fmt.Sprintf("TK-%d", 1000+len(mockTickets[ctx.VisitorID])+1)
-		mockTickets[ctx.VisitorID] = append(mockTickets[ctx.VisitorID], Ticket{
-			ID:        newID,
-			Title:     title,
-			Status:    "Open",
-			Priority:  priority,
-			CreatedAt: time.Now(),
-		})
+		return createTicketModal.Open()
+
+	case "view_ticket":
+		// Row click, SelectedID carries the ticket ID
+		tickets, _ := mockTickets.Get(ctx.VisitorID)
+		for _, t := range tickets {
+			if t.ID == ctx.SelectedID {
+				detail := tgo.NewKeyValue("").
+					Add("ID", t.ID, tgo.KeyValueCopyable(true)).
+					Add("标题", t.Title).
+					Add("状态", t.Status).
+					Add("优先级", t.Priority).
+					Add("创建时间", t.CreatedAt.Format("2006-01-02 15:04"))
+				return tgo.ShowModal("工单详情", detail)
+			}
+		}
+		return tgo.ShowToast("工单不存在", "error")
 
-		return tgo.ShowToast(fmt.Sprintf("工单 %s 创建成功", newID), "success").
-			Then(tgo.CloseModal()).
-			Then(tgo.Refresh())
 	}
 
 	return tgo.Noop()
@@ -168,56 +206,51 @@ func (p *TicketPlugin) OnToolExecute(ctx *tgo.ToolContext, toolName string, args
 
 	switch toolName {
 	case "create_ticket":
-		title, _ := args["title"].(string)
-		desc, _ := args["description"].(string)
-		priority, _ := args["priority"].(string)
-		if priority == "" {
-			priority = "medium"
-		}
+		values := tgo.Values(args)
+		title := values.String("title")
+		desc := values.String("description")
+		priority := values.String("priority")
 
 		if ctx.VisitorID == "" {
-			return &tgo.ToolResult{Success: false, Content: "无法识别访客，请在会话中调用。"}, nil
+			return tgo.NewToolResult("").Fail("无法识别访客，请在会话中调用。"), nil
+		}
+
+		// The host asks for confirmation first: describe the ticket without creating it
+		if ctx.DryRun {
+			return tgo.NewToolResult(fmt.Sprintf("将为访客创建工单，标题: %s, 优先级: %s。", title, priority)), nil
 		}
 
 		// Create ticket in mock DB
-		newID := fmt.Sprintf("TK-%d", 1000+len(mockTickets[ctx.VisitorID])+1)
-		mockTickets[ctx.VisitorID] = append(mockTickets[ctx.VisitorID], Ticket{
-			ID:        newID,
-			Title:     title,
-			Status:    "Open",
-			Priority:  priority,
-			CreatedAt: time.Now(),
-		})
+		newID := addTicket(ctx.VisitorID, title, priority)
 
-		return &tgo.ToolResult{
-			Success: true,
-			Content: fmt.Sprintf("成功为访客创建工单！工单 ID: %s, 标题: %s, 优先级: %s。描述: %s", newID, title, priority, desc),
-			Data: map[string]any{
+		return tgo.NewToolResult(fmt.Sprintf("成功为访客创建工单！工单 ID: %s, 标题: %s, 优先级: %s。描述: %s", newID, title, priority, desc)).
+			WithData(map[string]any{
 				"ticket_id": newID,
 				"status":    "Open",
-			},
-		}, nil
+			}), nil
 
 	case "list_tickets":
-		tickets := mockTickets[ctx.VisitorID]
+		tickets, _ := mockTickets.Get(ctx.VisitorID)
 		if len(tickets) == 0 {
-			return &tgo.ToolResult{Success: true, Content: "该访客目前没有工单。"}, nil
+			return tgo.NewToolResult("该访客目前没有工单。"), nil
 		}
 
 		content := "该访客的工单列表如下：\n"
 		for _, t := range tickets {
 			content += fmt.Sprintf("- [%s] %s (状态: %s, 优先级: %s)\n", t.ID, t.Title, t.Status, t.Priority)
 		}
-		return &tgo.ToolResult{Success: true, Content: content, Data: map[string]any{"tickets": tickets}}, nil
+		return tgo.NewToolResult(content).WithData(map[string]any{"tickets": tickets}), nil
 	}
 
-	return &tgo.ToolResult{Success: false, Content: "未知工具"}, nil
+	return tgo.NewToolResult("").Fail("未知工具"), nil
 }
 
 func main() {
 	// Start the plugin, connecting to the TGO API via TCP
 	// Use 8005 for local debugging with Docker-based TGO API
-	if err := tgo.Run(&TicketPlugin{}); err != nil {
+	// Retried create_ticket calls reuse their idempotency key and must not
+	// create a second ticket
+	if err := tgo.Run(&TicketPlugin{}, tgo.WithIdempotency(10*time.Minute)); err != nil {
 		log.Fatalf("Ticket Plugin failed: %v", err)
 	}
 }
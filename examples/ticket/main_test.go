@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tgoai/tgo-plugin-go"
+	"github.com/tgoai/tgo-plugin-go/tgotest"
+)
+
+func ExampleTicketPlugin_OnVisitorPanelRender() {
+	h, err := tgotest.New(&TicketPlugin{})
+	if err != nil {
+		panic(err)
+	}
+	defer h.Close()
+
+	got, err := h.RenderVisitorPanel(&tgo.RenderContext{VisitorID: "visitor_1"})
+	if err != nil {
+		panic(err)
+	}
+
+	items := got["data"].(map[string]any)["items"].([]any)
+	table := items[1].(map[string]any)
+	fmt.Println(got["template"], len(items), table["template"])
+	for _, row := range table["data"].(map[string]any)["rows"].([]any) {
+		fmt.Println(row.(map[string]any)["ID"])
+	}
+	// Output:
+	// group 2 table
+	// TK-1001
+	// TK-1002
+}
+
+func TestTicketTable(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tickets := []Ticket{{ID: "TK-1", Title: "Login fails", Status: "Open", Priority: "High", CreatedAt: created}}
+
+	table := tgo.TableFromStructs("Tickets", tickets)
+	want := []map[string]any{{"id": "TK-1", "title": "Login fails", "status": "Open", "priority": "High", "created_at": created}}
+	if !reflect.DeepEqual(table.RowsArr, want) {
+		t.Errorf("all columns: got %v, want %v", table.RowsArr, want)
+	}
+
+	table = tgo.TableFromStructs("Tickets", tickets, "title", "id")
+	var keys []any
+	for _, col := range table.ColumnsArr {
+		keys = append(keys, col["key"])
+	}
+	if !reflect.DeepEqual(keys, []any{"title", "id"}) {
+		t.Errorf("selected columns: got %v", keys)
+	}
+	want = []map[string]any{{"id": "TK-1", "title": "Login fails"}}
+	if !reflect.DeepEqual(table.RowsArr, want) {
+		t.Errorf("selected columns: got rows %v, want %v", table.RowsArr, want)
+	}
+}
@@ -0,0 +1,68 @@
+package tgo
+
+// FormModal bundles a Form shown in a modal with the callback handling its
+// submission. Submit events carrying its action id are routed to the callback
+// by the SDK instead of OnVisitorPanelEvent or OnChatToolbarEvent, provided
+// the plugin lists the modal with FormModalProvider:
+//
+//	var createTicket = tgo.NewFormModal("create_ticket", "New ticket", form, onCreateTicket)
+//
+//	func (p *TicketPlugin) FormModals() []*tgo.FormModal {
+//		return []*tgo.FormModal{createTicket}
+//	}
+//
+//	func (p *TicketPlugin) OnChatToolbarEvent(ctx *tgo.EventContext) *tgo.Action {
+//		return createTicket.Open()
+//	}
+type FormModal struct {
+	actionID string
+	title    string
+	form     *Form
+	onSubmit func(ctx *EventContext) *Action
+}
+
+// NewFormModal creates a form modal showing a copy of form that submits with
+// actionID, handled by onSubmit. form itself is left unchanged.
+func NewFormModal(actionID, title string, form *Form, onSubmit func(ctx *EventContext) *Action) *FormModal {
+	return &FormModal{actionID: actionID, title: title, form: form.Clone().SubmitAction(actionID), onSubmit: onSubmit}
+}
+
+// FormModalProvider lists the form modals whose submissions Run routes to
+// their callbacks. It is consulted once when Run starts; the routing ends
+// when Run returns. Of several modals with the same action id, the last wins.
+type FormModalProvider interface {
+	FormModals() []*FormModal
+}
+
+// ActionID returns the action id the form submits with.
+func (m *FormModal) ActionID() string { return m.actionID }
+
+// Open returns the action showing the form modal.
+func (m *FormModal) Open() *Action {
+	return ShowModal(m.title, m.form)
+}
+
+// formModals indexes the form modals of p by action id.
+func formModals(p Plugin) map[string]*FormModal {
+	h, ok := p.(FormModalProvider)
+	if !ok {
+		return nil
+	}
+	modals := map[string]*FormModal{}
+	for _, m := range h.FormModals() {
+		if m != nil {
+			modals[m.actionID] = m
+		}
+	}
+	return modals
+}
+
+// submitFormModal runs the callback of the form modal in modals submitting
+// with ctx.ActionID, if any.
+func submitFormModal(modals map[string]*FormModal, ctx *EventContext) (*Action, bool) {
+	m, ok := modals[ctx.ActionID]
+	if !ok || m.onSubmit == nil {
+		return nil, false
+	}
+	return m.onSubmit(ctx), true
+}
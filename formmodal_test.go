@@ -0,0 +1,70 @@
+package tgo_test
+
+import (
+	"testing"
+
+	"github.com/tgoai/tgo-plugin-go"
+	"github.com/tgoai/tgo-plugin-go/tgotest"
+)
+
+type modalPlugin struct {
+	tgo.BasePlugin
+	modal *tgo.FormModal
+}
+
+func (p *modalPlugin) FormModals() []*tgo.FormModal { return []*tgo.FormModal{p.modal} }
+
+func (p *modalPlugin) OnVisitorPanelEvent(ctx *tgo.EventContext) *tgo.Action {
+	return tgo.ShowToast("unrouted "+ctx.ActionID, "info")
+}
+
+func newModalHarness(t *testing.T, message string) *tgotest.Harness {
+	t.Helper()
+	modal := tgo.NewFormModal("submit", "Title", tgo.NewForm("Form"), func(ctx *tgo.EventContext) *tgo.Action {
+		return tgo.ShowToast(message, "success")
+	})
+	h, err := tgotest.New(&modalPlugin{BasePlugin: *testPlugin(), modal: modal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func toastMessage(t *testing.T, h *tgotest.Harness, actionID string) any {
+	t.Helper()
+	got, err := h.VisitorPanelEvent(&tgo.EventContext{ActionID: actionID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := got["data"].(map[string]any)
+	return data["message"]
+}
+
+func TestFormModalsAreScopedToPlugin(t *testing.T) {
+	first := newModalHarness(t, "first")
+	second := newModalHarness(t, "second")
+
+	if got := toastMessage(t, first, "submit"); got != "first" {
+		t.Errorf("first plugin: got %v", got)
+	}
+	if got := toastMessage(t, second, "submit"); got != "second" {
+		t.Errorf("second plugin: got %v", got)
+	}
+	if got := toastMessage(t, first, "other"); got != "unrouted other" {
+		t.Errorf("other action: got %v", got)
+	}
+}
+
+func TestNewFormModalKeepsForm(t *testing.T) {
+	form := tgo.NewForm("Form").SubmitAction("original")
+	modal := tgo.NewFormModal("submit", "Title", form, nil)
+
+	if form.SubmitActionID != "original" {
+		t.Errorf("form submit action changed to %v", form.SubmitActionID)
+	}
+	data := tgotest.ToMap(modal.Open())["data"].(map[string]any)
+	if got := data["data"].(map[string]any)["submit_action_id"]; got != "submit" {
+		t.Errorf("modal submits with %v, want submit", got)
+	}
+}
@@ -0,0 +1,132 @@
+package tgo
+
+import "fmt"
+
+// HostClient issues JSON-RPC requests back to the TGO host over the plugin's
+// connection. It is available as the Host field of handler contexts.
+type HostClient struct {
+	t       *Transport
+	enabled *enablement // Capabilities reset by UpdateCapabilities, nil outside handlers
+}
+
+// NewHostClient creates a HostClient on top of t.
+func NewHostClient(t *Transport) *HostClient {
+	return &HostClient{t: t}
+}
+
+// Call invokes an arbitrary host method and returns its result.
+func (c *HostClient) Call(method string, params any) (map[string]any, error) {
+	if c == nil || c.t == nil {
+		return nil, ErrNotConnected
+	}
+	return c.t.Call(method, params)
+}
+
+// ProtocolVersion returns the protocol version agreed with the host.
+func (c *HostClient) ProtocolVersion() int {
+	if c == nil || c.t == nil {
+		return 0
+	}
+	return c.t.ProtocolVersion()
+}
+
+// Notify sends a JSON-RPC notification: the host processes it without
+// replying, so Notify returns once the message is written and any error is
+// a transport failure. It may be called at any time, e.g. from a scheduled
+// task. The host accepts:
+//
+//	plugin/notify   {"title": ..., "body": ..., "level": "info|success|warning|error"}
+//	                shows a notification to agents, see NotifyAgents
+//	tool/progress   sent by ToolStream.Emit
+//
+// Other methods are ignored by the host.
+func (c *HostClient) Notify(method string, params any) error {
+	if c == nil || c.t == nil {
+		return ErrNotConnected
+	}
+	return c.t.SendMessage(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+}
+
+// NotifyAgents shows a notification such as "sync complete" to the agents of
+// the workspace. level is one of info, success, warning or error.
+func (c *HostClient) NotifyAgents(title, body, level string) error {
+	return c.Notify("plugin/notify", map[string]any{"title": title, "body": body, "level": level})
+}
+
+// UpdateCapabilities re-announces the plugin's capabilities while it runs,
+// e.g. to add MCP tools loaded from remote configuration. The host replaces
+// the capabilities declared at registration with caps, and so does the SDK:
+// tool definitions are looked up in a copy of caps from then on, and the
+// plugin's Capabilities method is not consulted again. Enablement starts
+// over as at registration: capability types declared with WithEnabled(false)
+// are disabled, types no longer declared are disabled and all others are
+// enabled. Only the Host of a handler context updates the SDK; a HostClient
+// from NewHostClient just informs the host.
+func (c *HostClient) UpdateCapabilities(caps []Capability) error {
+	if err := validateCapabilities(caps); err != nil {
+		return fmt.Errorf("invalid capabilities: %w", err)
+	}
+	if _, err := c.Call("capabilities/update", map[string]any{"capabilities": caps}); err != nil {
+		return err
+	}
+	if c.enabled != nil {
+		c.enabled.reset(caps)
+	}
+	return nil
+}
+
+// GetVisitor fetches the full visitor profile.
+func (c *HostClient) GetVisitor(visitorID string) (*Visitor, error) {
+	result, err := c.Call("visitor/get", map[string]any{"visitor_id": visitorID})
+	if err != nil {
+		return nil, err
+	}
+	v := &Visitor{}
+	if err := mapToStruct(result, v); err != nil {
+		return nil, fmt.Errorf("invalid visitor from host: %w", err)
+	}
+	return v, nil
+}
+
+// SendMessage posts a message to the visitor of a session out-of-band.
+func (c *HostClient) SendMessage(sessionID, content, contentType string) error {
+	_, err := c.Call("message/send", map[string]any{
+		"session_id":   sessionID,
+		"content":      content,
+		"content_type": contentType,
+	})
+	return err
+}
+
+// SendChannelMessage sends content to the external user to on a channel
+// integration, e.g. from a ChannelMessageHandler. Event handlers may return
+// the SendChannelMessage action instead.
+func (c *HostClient) SendChannelMessage(channelID, to, content string) error {
+	_, err := c.Call("channel_message/send", map[string]any{
+		"channel_id": channelID,
+		"to":         to,
+		"content":    content,
+	})
+	return err
+}
+
+// GetMessages fetches up to limit most recent messages of a session, oldest first.
+// History is not included in handler contexts except for tools declared
+// with ToolBuilder.IncludeHistory.
+func (c *HostClient) GetMessages(sessionID string, limit int) ([]Message, error) {
+	result, err := c.Call("messages/list", map[string]any{"session_id": sessionID, "limit": limit})
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Messages []Message `json:"messages"`
+	}
+	if err := mapToStruct(result, &resp); err != nil {
+		return nil, fmt.Errorf("invalid messages from host: %w", err)
+	}
+	return resp.Messages, nil
+}
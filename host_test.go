@@ -0,0 +1,120 @@
+package tgo_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tgoai/tgo-plugin-go"
+	"github.com/tgoai/tgo-plugin-go/tgotest"
+)
+
+type dynamicPlugin struct {
+	tgo.BasePlugin
+	next []tgo.Capability
+}
+
+func (p *dynamicPlugin) OnScheduledTask(ctx *tgo.TaskContext) error {
+	return ctx.Host.UpdateCapabilities(p.next)
+}
+
+func (p *dynamicPlugin) OnToolExecute(ctx *tgo.ToolContext, name string, args map[string]any) (*tgo.ToolResult, error) {
+	return tgo.NewToolResult("found " + args["id"].(string)), nil
+}
+
+func (p *dynamicPlugin) OnVisitorPanelRender(ctx *tgo.RenderContext) tgo.Template {
+	return tgo.NewText("panel")
+}
+
+func (p *dynamicPlugin) OnChatToolbarRender(ctx *tgo.RenderContext) tgo.Template {
+	return tgo.NewText("toolbar")
+}
+
+func TestUpdateCapabilitiesResetsEnablement(t *testing.T) {
+	task := tgo.ScheduledTask("reload", "0 * * * *")
+	p := &dynamicPlugin{
+		BasePlugin: tgo.BasePlugin{PID: "dyn", PName: "Dyn", PVersion: "1.0.0", Caps: []tgo.Capability{
+			task,
+			tgo.VisitorPanel("Panel"),
+			tgo.ChatToolbar("Toolbar", tgo.WithEnabled(false)),
+		}},
+		next: []tgo.Capability{task, tgo.ChatToolbar("Toolbar")},
+	}
+	h, err := tgotest.New(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	var updated []any
+	h.Handle("capabilities/update", func(params map[string]any) (any, error) {
+		updated, _ = params["capabilities"].([]any)
+		return map[string]any{"success": true}, nil
+	})
+
+	disabled := func(method string) bool {
+		_, err := h.Call(method, map[string]any{})
+		var rerr *tgo.RPCError
+		return errors.As(err, &rerr) && rerr.Code == tgo.CodeDisabled
+	}
+	if disabled("visitor_panel/render") || !disabled("chat_toolbar/render") {
+		t.Fatal("unexpected enablement before the update")
+	}
+
+	if _, err := h.Call("task/run", map[string]any{"task_name": "reload"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 2 {
+		t.Fatalf("host received %d capabilities, want 2", len(updated))
+	}
+	if !disabled("visitor_panel/render") {
+		t.Error("removed visitor panel is still enabled")
+	}
+	if disabled("chat_toolbar/render") {
+		t.Error("chat toolbar is still disabled after being declared enabled")
+	}
+}
+
+func TestUpdateCapabilitiesAddsTool(t *testing.T) {
+	task := tgo.ScheduledTask("reload", "0 * * * *")
+	lookup := tgo.MCPTools(tgo.Tool("lookup", "Lookup").String("id", "Record id", false, tgo.ParamDefault("C-0"), tgo.ParamMinLength(3)))
+	p := &dynamicPlugin{
+		BasePlugin: tgo.BasePlugin{PID: "dyn", PName: "Dyn", PVersion: "1.0.0", Caps: []tgo.Capability{task}},
+		next:       []tgo.Capability{task, lookup},
+	}
+	h, err := tgotest.New(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	h.Handle("capabilities/update", func(params map[string]any) (any, error) {
+		return map[string]any{"success": true}, nil
+	})
+
+	if _, err := h.Call("task/run", map[string]any{"task_name": "reload"}); err != nil {
+		t.Fatal(err)
+	}
+	p.next = nil // The SDK keeps its own copy
+
+	// The definition of the added tool applies: defaults are filled in and
+	// arguments validated before the handler runs.
+	got, err := h.ExecuteTool(&tgo.ToolContext{}, "lookup", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["content"] != "found C-0" {
+		t.Errorf("missing argument: got %v, want the default", got)
+	}
+	got, err = h.ExecuteTool(&tgo.ToolContext{}, "lookup", map[string]any{"id": "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["success"] != false {
+		t.Errorf("short argument: got %v, want a validation failure", got)
+	}
+	got, err = h.ExecuteTool(&tgo.ToolContext{}, "lookup", map[string]any{"id": "C-12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["success"] != true || got["content"] != "found C-12" {
+		t.Errorf("got %v", got)
+	}
+}
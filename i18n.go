@@ -0,0 +1,63 @@
+package tgo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bundle holds translated texts by locale and key.
+type Bundle struct {
+	defaultLocale string
+	messages      map[string]map[string]string
+}
+
+// NewBundle creates a Bundle from locale -> key -> text. Lookups fall back to
+// defaultLocale when a locale or key is missing.
+func NewBundle(defaultLocale string, messages map[string]map[string]string) *Bundle {
+	return &Bundle{defaultLocale: defaultLocale, messages: messages}
+}
+
+// T returns the text for key in locale, formatted with args via fmt.Sprintf
+// when args are given. A regional locale such as "en-US" falls back to "en",
+// then to the default locale; an unknown key is returned as is.
+func (b *Bundle) T(locale, key string, args ...any) string {
+	text := key
+	if b != nil {
+		if s, ok := b.lookup(locale, key); ok {
+			text = s
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+func (b *Bundle) lookup(locale, key string) (string, bool) {
+	candidates := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, b.defaultLocale)
+	for _, l := range candidates {
+		if s, ok := b.messages[l][key]; ok {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// T translates key into the request language using the bundle set with WithI18n.
+func (c *RenderContext) T(key string, args ...any) string {
+	return c.i18n.T(c.Language, key, args...)
+}
+
+// T translates key into the request language using the bundle set with WithI18n.
+func (c *EventContext) T(key string, args ...any) string {
+	return c.i18n.T(c.Language, key, args...)
+}
+
+// T translates key into the request language using the bundle set with WithI18n.
+func (c *ToolContext) T(key string, args ...any) string {
+	return c.i18n.T(c.Language, key, args...)
+}
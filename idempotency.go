@@ -0,0 +1,111 @@
+package tgo
+
+import (
+	"sync"
+	"time"
+)
+
+// idempotencyCache remembers the responses of requests carrying an
+// idempotency key, so retries of the same operation are answered without
+// running the handler again. See WithIdempotency.
+type idempotencyCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	done    chan struct{} // Closed once resp is set
+	resp    map[string]any
+	expires time.Time
+}
+
+// maxIdempotencyKeys bounds the number of remembered keys; beyond it expired
+// entries are dropped.
+const maxIdempotencyKeys = 10000
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{ttl: ttl, entries: map[string]*idempotencyEntry{}}
+}
+
+// do returns the response of fn for key. The first call runs fn; calls with
+// the same key within the TTL wait for it and receive the same response.
+// Error responses and failed tool results are not remembered, so a
+// duplicate of a failed request runs fn itself. The second result reports whether the response was replayed.
+func (c *idempotencyCache) do(key string, fn func() map[string]any) (map[string]any, bool) {
+	for {
+		c.mu.Lock()
+		now := time.Now()
+		e, ok := c.entries[key]
+		if ok && isClosed(e.done) && now.After(e.expires) {
+			delete(c.entries, key)
+			ok = false
+		}
+		if !ok {
+			if len(c.entries) >= maxIdempotencyKeys {
+				c.prune(now)
+			}
+			e = &idempotencyEntry{done: make(chan struct{})}
+			c.entries[key] = e
+			c.mu.Unlock()
+			return c.run(key, e, fn), false
+		}
+		c.mu.Unlock()
+
+		<-e.done
+		if e.resp != nil {
+			return e.resp, true
+		}
+	}
+}
+
+// run calls fn for the entry e owned by the caller and publishes its response.
+func (c *idempotencyCache) run(key string, e *idempotencyEntry, fn func() map[string]any) (resp map[string]any) {
+	defer func() {
+		c.mu.Lock()
+		if replayable(resp) {
+			e.resp = resp
+			e.expires = time.Now().Add(c.ttl)
+		} else {
+			// Failed or panicked, let the next attempt run again.
+			delete(c.entries, key)
+		}
+		close(e.done)
+		c.mu.Unlock()
+	}()
+	return fn()
+}
+
+// replayable reports whether resp may be replayed to duplicates. Failures,
+// including tool results such as a timeout or rate limiting, are often
+// transient and must not stick for the whole TTL.
+func replayable(resp map[string]any) bool {
+	if resp == nil || resp["error"] != nil {
+		return false
+	}
+	switch r := resp["result"].(type) {
+	case *ToolResult:
+		return r == nil || r.Success
+	case map[string]any:
+		return r["success"] != false
+	}
+	return true
+}
+
+func (c *idempotencyCache) prune(now time.Time) {
+	for key, e := range c.entries {
+		if isClosed(e.done) && now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
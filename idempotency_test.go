@@ -0,0 +1,136 @@
+package tgo_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tgoai/tgo-plugin-go"
+	"github.com/tgoai/tgo-plugin-go/tgotest"
+)
+
+type idempotentPlugin struct {
+	tgo.BasePlugin
+	calls atomic.Int64
+	exec  func(call int64) *tgo.ToolResult
+}
+
+func (p *idempotentPlugin) OnToolExecute(ctx *tgo.ToolContext, name string, args map[string]any) (*tgo.ToolResult, error) {
+	return p.exec(p.calls.Add(1)), nil
+}
+
+func newIdempotentHarness(t *testing.T, tool *tgo.ToolBuilder, exec func(call int64) *tgo.ToolResult, opts ...tgo.Option) (*tgotest.Harness, *idempotentPlugin) {
+	t.Helper()
+	p := &idempotentPlugin{
+		BasePlugin: tgo.BasePlugin{PID: "idem", PName: "Idem", PVersion: "1.0.0", Caps: []tgo.Capability{tgo.MCPTools(tool)}},
+		exec:       exec,
+	}
+	h, err := tgotest.New(p, append(opts, tgo.WithIdempotency(time.Minute))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h, p
+}
+
+func TestIdempotencyReplaysSuccess(t *testing.T) {
+	h, p := newIdempotentHarness(t, tgo.Tool("create", "Create"), func(call int64) *tgo.ToolResult {
+		return tgo.NewToolResult("created")
+	})
+
+	ctx := &tgo.ToolContext{VisitorID: "v1", IdempotencyKey: "op-1"}
+	for range 3 {
+		got, err := h.ExecuteTool(ctx, "create", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["success"] != true {
+			t.Fatalf("unexpected result %v", got)
+		}
+	}
+	if n := p.calls.Load(); n != 1 {
+		t.Fatalf("handler ran %d times, want 1", n)
+	}
+}
+
+func TestIdempotencyRetriesAfterTimeout(t *testing.T) {
+	h, p := newIdempotentHarness(t, tgo.Tool("create", "Create").Timeout(20*time.Millisecond), func(call int64) *tgo.ToolResult {
+		if call == 1 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return tgo.NewToolResult("created")
+	})
+
+	ctx := &tgo.ToolContext{VisitorID: "v1", IdempotencyKey: "op-1"}
+	got, err := h.ExecuteTool(ctx, "create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["error"] != "timeout" {
+		t.Fatalf("first attempt: got %v, want a timeout", got)
+	}
+
+	got, err = h.ExecuteTool(ctx, "create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["success"] != true {
+		t.Fatalf("retry replayed the timeout: %v", got)
+	}
+	if n := p.calls.Load(); n != 2 {
+		t.Fatalf("handler ran %d times, want 2", n)
+	}
+}
+
+func TestIdempotencyRetriesAfterRateLimit(t *testing.T) {
+	h, p := newIdempotentHarness(t, tgo.Tool("create", "Create").RateLimit(1, 50*time.Millisecond), func(call int64) *tgo.ToolResult {
+		return tgo.NewToolResult("created")
+	})
+
+	if _, err := h.ExecuteTool(&tgo.ToolContext{IdempotencyKey: "op-1"}, "create", nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &tgo.ToolContext{IdempotencyKey: "op-2"}
+	got, err := h.ExecuteTool(ctx, "create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["error"] != "rate limited" {
+		t.Fatalf("second operation: got %v, want rate limited", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	got, err = h.ExecuteTool(ctx, "create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["success"] != true {
+		t.Fatalf("retry replayed the rate limit: %v", got)
+	}
+	if n := p.calls.Load(); n != 2 {
+		t.Fatalf("handler ran %d times, want 2", n)
+	}
+}
+
+func TestIdempotencyRetriesFailedResult(t *testing.T) {
+	h, p := newIdempotentHarness(t, tgo.Tool("create", "Create"), func(call int64) *tgo.ToolResult {
+		if call == 1 {
+			return tgo.NewToolResult("").Fail("crm unavailable")
+		}
+		return tgo.NewToolResult("created")
+	})
+
+	ctx := &tgo.ToolContext{IdempotencyKey: "op-1"}
+	for _, want := range []any{false, true, true} {
+		got, err := h.ExecuteTool(ctx, "create", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["success"] != want {
+			t.Fatalf("got %v, want success %v", got, want)
+		}
+	}
+	if n := p.calls.Load(); n != 2 {
+		t.Fatalf("handler ran %d times, want 2", n)
+	}
+}
@@ -0,0 +1,72 @@
+package tgo
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger is the structured logger used by the SDK. kv is a flat list of
+// alternating keys and values, e.g. Info("request", "method", m, "id", id).
+type Logger interface {
+	Debug(msg string, kv ...any)
+	Info(msg string, kv ...any)
+	Warn(msg string, kv ...any)
+	Error(msg string, kv ...any)
+}
+
+// WithFields returns a Logger that appends kv to every entry logged through l.
+func WithFields(l Logger, kv ...any) Logger {
+	if f, ok := l.(*fieldLogger); ok {
+		return &fieldLogger{l: f.l, kv: append(append([]any{}, f.kv...), kv...)}
+	}
+	return &fieldLogger{l: l, kv: kv}
+}
+
+type fieldLogger struct {
+	l  Logger
+	kv []any
+}
+
+func (f *fieldLogger) Debug(msg string, kv ...any) { f.l.Debug(msg, append(kv, f.kv...)...) }
+func (f *fieldLogger) Info(msg string, kv ...any)  { f.l.Info(msg, append(kv, f.kv...)...) }
+func (f *fieldLogger) Warn(msg string, kv ...any)  { f.l.Warn(msg, append(kv, f.kv...)...) }
+func (f *fieldLogger) Error(msg string, kv ...any) { f.l.Error(msg, append(kv, f.kv...)...) }
+
+// StdLogger is a Logger backed by the standard log package.
+type StdLogger struct {
+	Logger  *log.Logger // Defaults to log.Default() when nil
+	Verbose bool        // Emit Debug messages
+}
+
+// NewStdLogger creates a StdLogger writing to log.Default().
+func NewStdLogger(verbose bool) *StdLogger {
+	return &StdLogger{Verbose: verbose}
+}
+
+func (l *StdLogger) Debug(msg string, kv ...any) {
+	if l.Verbose {
+		l.output("DEBUG", msg, kv)
+	}
+}
+
+func (l *StdLogger) Info(msg string, kv ...any)  { l.output("INFO", msg, kv) }
+func (l *StdLogger) Warn(msg string, kv ...any)  { l.output("WARN", msg, kv) }
+func (l *StdLogger) Error(msg string, kv ...any) { l.output("ERROR", msg, kv) }
+
+func (l *StdLogger) output(level, msg string, kv []any) {
+	var b strings.Builder
+	b.WriteString("[" + level + "] " + msg)
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 < len(kv) {
+			fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v=(MISSING)", kv[i])
+		}
+	}
+	logger := l.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Print(b.String())
+}
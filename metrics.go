@@ -0,0 +1,14 @@
+package tgo
+
+import "time"
+
+// MetricsHook receives per-request observability events, e.g. to bridge to
+// Prometheus. It is called inline after each request, so implementations
+// must be safe for concurrent use and must not block. Transport level
+// counters are available from Transport.Stats; create the transport yourself
+// and pass it with WithTransport to keep a reference to it.
+type MetricsHook interface {
+	// RequestHandled reports a handled request. err is nil on success and
+	// carries the JSON-RPC error message otherwise.
+	RequestHandled(method string, duration time.Duration, err error)
+}
@@ -0,0 +1,116 @@
+package tgo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Request is an incoming JSON-RPC call as seen by middleware.
+type Request struct {
+	ID      any
+	TraceID string // Host provided params.trace_id, if any
+	Method  string
+	Params  map[string]any
+	Host    *HostClient
+	Logger  Logger          // Tags every entry with the request and trace id
+	Context context.Context // Middleware may replace it, e.g. to add a deadline
+
+	i18n        *Bundle
+	toolTimeout time.Duration
+	enablement  *enablement
+	limiter     *rateLimiter
+	formModals  map[string]*FormModal
+}
+
+// requestInfo is embedded in handler contexts to expose per-request data.
+type requestInfo struct {
+	requestID string
+	traceID   string
+	logger    Logger
+	ctx       context.Context
+	enabled   *enablement
+}
+
+// RequestID returns the JSON-RPC id of the request being handled.
+func (r *requestInfo) RequestID() string { return r.requestID }
+
+// TraceID returns the host provided trace id of the request, if any.
+func (r *requestInfo) TraceID() string { return r.traceID }
+
+// Logger returns a logger tagging every entry with the request and trace id.
+func (r *requestInfo) Logger() Logger {
+	if r.logger == nil {
+		return NewStdLogger(false)
+	}
+	return r.logger
+}
+
+// RequestContext returns the context of the request. Long running handlers
+// should stop when it is done.
+func (r *requestInfo) RequestContext() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+func (r *requestInfo) bind(req *Request) {
+	r.requestID = fmt.Sprint(req.ID)
+	r.traceID = req.TraceID
+	r.logger = req.Logger
+	r.ctx = req.Context
+	r.enabled = req.enablement
+}
+
+// CapabilityEnabled reports whether capabilities of type capType, e.g.
+// "mcp_tools", are currently enabled.
+func (r *requestInfo) CapabilityEnabled(capType string) bool {
+	return r.enabled.enabled(capType)
+}
+
+// decode fills a handler context from the request params and attaches the host client.
+// A decoding failure is reported as a JSON-RPC invalid params error.
+func (r *Request) decode(ctx any) error {
+	if err := mapToStruct(r.Params, ctx); err != nil {
+		return &RPCError{Code: CodeInvalidParams, Message: fmt.Sprintf("invalid params for %s: %v", r.Method, err)}
+	}
+	if c, ok := ctx.(interface{ bind(*Request) }); ok {
+		c.bind(r)
+	}
+	switch c := ctx.(type) {
+	case *RenderContext:
+		c.Host, c.i18n = r.Host, r.i18n
+	case *EventContext:
+		c.Host, c.i18n = r.Host, r.i18n
+	case *ToolContext:
+		c.Host, c.i18n = r.Host, r.i18n
+	case *TaskContext:
+		c.Host = r.Host
+	case *WebhookContext:
+		c.Host = r.Host
+	case *ChannelContext:
+		c.Host = r.Host
+	}
+	return nil
+}
+
+// HandlerFunc handles a request and returns its result or an error.
+type HandlerFunc func(req *Request) (any, error)
+
+// Middleware wraps a HandlerFunc. It may inspect or modify the request,
+// short-circuit by returning an error without calling next, or post-process
+// the result.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// TimingMiddleware logs the duration of every handled request at Debug level.
+func TimingMiddleware(l Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(req *Request) (any, error) {
+			start := time.Now()
+			result, err := next(req)
+			l.Debug("request handled", "method", req.Method, "id", req.ID, "trace_id", req.TraceID, "duration", time.Since(start), "error", err)
+			return result, err
+		}
+	}
+}
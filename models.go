@@ -1,17 +1,41 @@
 package tgo
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
 // Capability defines a plugin's extension point.
 type Capability struct {
-	Type      string              `json:"type"`
-	Title     string              `json:"title"`
-	Icon      string              `json:"icon,omitempty"`
-	Priority  int                 `json:"priority,omitempty"`
-	Tooltip   string              `json:"tooltip,omitempty"`
-	Shortcut  string              `json:"shortcut,omitempty"`
-	URL       string              `json:"url,omitempty"`
-	Width     int                 `json:"width,omitempty"`
-	RefreshOn []string            `json:"refresh_on,omitempty"`
-	Tools     []MCPToolDefinition `json:"tools,omitempty"` // For mcp_tools type
+	Type        string              `json:"type"`
+	Title       string              `json:"title"`
+	Icon        string              `json:"icon,omitempty"`
+	Priority    int                 `json:"priority,omitempty"`
+	Tooltip     string              `json:"tooltip,omitempty"`
+	Shortcut    string              `json:"shortcut,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Width       int                 `json:"width,omitempty"`
+	RefreshOn   []string            `json:"refresh_on,omitempty"`
+	Path        string              `json:"path,omitempty"`        // For webhook type
+	Command     string              `json:"command,omitempty"`     // For slash_command type
+	Description string              `json:"description,omitempty"` // For slash_command type
+	Args        []SlashCommandArg   `json:"args,omitempty"`        // For slash_command type
+	Name        string              `json:"name,omitempty"`        // For scheduled_task type
+	Cron        string              `json:"cron,omitempty"`        // For scheduled_task type
+	Timezone    string              `json:"timezone,omitempty"`    // For scheduled_task type, IANA name
+	Tools       []MCPToolDefinition `json:"tools,omitempty"`       // For mcp_tools type
+
+	RefreshDebounceMs int                `json:"refresh_debounce_ms,omitempty"` // Coalesces RefreshOn re-renders
+	Enabled           *bool              `json:"enabled,omitempty"`             // nil means enabled
+	ConfigSchema      []MCPToolParameter `json:"config_schema,omitempty"`       // Per-install settings, see WithConfigSchema
+	RefreshFilter     map[string]string  `json:"refresh_filter,omitempty"`      // Narrows RefreshOn, see WithRefreshFilter
 }
 
 // CapabilityOption is a function to configure a Capability.
@@ -37,6 +61,77 @@ func WithWidth(w int) CapabilityOption {
 	return func(c *Capability) { c.Width = w }
 }
 
+// WithRefreshOn re-renders the capability when the host sees one of the events.
+func WithRefreshOn(events ...string) CapabilityOption {
+	return func(c *Capability) { c.RefreshOn = append(c.RefreshOn, events...) }
+}
+
+// WithRefreshDebounce makes the host coalesce RefreshOn re-renders of the
+// capability, rendering at most once per d.
+func WithRefreshDebounce(d time.Duration) CapabilityOption {
+	return func(c *Capability) { c.RefreshDebounceMs = int(d.Milliseconds()) }
+}
+
+// WithRefreshFilter restricts RefreshOn re-renders to events whose payload
+// field key equals value. The host evaluates the filter without calling the
+// plugin. A value of "$visitor_id", "$session_id" or "$agent_id" stands for
+// that ID in the context the capability is shown in, so
+//
+//	tgo.VisitorPanel("Tickets",
+//		tgo.WithRefreshOn("ticket_updated"),
+//		tgo.WithRefreshFilter("visitor_id", "$visitor_id"))
+//
+// re-renders a panel only for tickets of the visitor it shows. Nested payload
+// fields are addressed with dots, e.g. "ticket.visitor_id". Any other value is
+// compared literally with the field formatted as a string. With several
+// filters, all must match; an event lacking the field does not match.
+func WithRefreshFilter(key, value string) CapabilityOption {
+	return func(c *Capability) {
+		if c.RefreshFilter == nil {
+			c.RefreshFilter = map[string]string{}
+		}
+		c.RefreshFilter[key] = value
+	}
+}
+
+// WithConfigSchema declares per-install configuration of the capability, e.g.
+// the URL of a SidebarIframe. The host renders a form from fields when the
+// capability is installed and sends the saved values as Config in every
+// RenderContext and EventContext of this capability.
+func WithConfigSchema(fields ...MCPToolParameter) CapabilityOption {
+	return func(c *Capability) { c.ConfigSchema = append(c.ConfigSchema, fields...) }
+}
+
+// ConfigField describes a configuration field for WithConfigSchema. tp is
+// string, number, boolean or enum; enum values are set with ParamEnum.
+func ConfigField(name, tp, desc string, required bool, opts ...ParamOption) MCPToolParameter {
+	p := MCPToolParameter{Name: name, Type: tp, Description: desc, Required: required}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return p
+}
+
+// WithEnabled declares whether the capability starts enabled. The host may
+// override it at registration or at runtime via "capabilities/set_enabled".
+func WithEnabled(enabled bool) CapabilityOption {
+	return func(c *Capability) { c.Enabled = &enabled }
+}
+
+// WithCommandArg declares an argument hint used by the host to autocomplete a slash command.
+func WithCommandArg(name, desc string, required bool, choices ...string) CapabilityOption {
+	return func(c *Capability) {
+		c.Args = append(c.Args, SlashCommandArg{
+			Name: name, Description: desc, Required: required, Choices: choices,
+		})
+	}
+}
+
+// WithTimezone sets the IANA timezone (e.g. "Asia/Shanghai") a scheduled task's cron expression is evaluated in.
+func WithTimezone(tz string) CapabilityOption {
+	return func(c *Capability) { c.Timezone = tz }
+}
+
 // VisitorPanel creates a visitor_panel capability.
 func VisitorPanel(title string, opts ...CapabilityOption) Capability {
 	c := Capability{Type: "visitor_panel", Title: title, Priority: 10}
@@ -64,6 +159,79 @@ func SidebarIframe(title string, url string, opts ...CapabilityOption) Capabilit
 	return c
 }
 
+// DashboardWidget creates a dashboard_widget capability shown on the agent home screen.
+func DashboardWidget(title string, opts ...CapabilityOption) Capability {
+	c := Capability{Type: "dashboard_widget", Title: title}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// SettingsPage creates a settings_page capability for admin configuration.
+func SettingsPage(title string, opts ...CapabilityOption) Capability {
+	c := Capability{Type: "settings_page", Title: title}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// Webhook creates a webhook capability. The host exposes it publicly at
+// {TGO base URL}/api/plugins/{plugin ID}/webhooks{path} and forwards each
+// HTTP request received there to the plugin as a webhook/invoke call.
+func Webhook(path string, opts ...CapabilityOption) Capability {
+	c := Capability{Type: "webhook", Title: path, Path: path}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// SlashCommandArg describes an argument of a slash command.
+type SlashCommandArg struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Required    bool     `json:"required"`
+	Choices     []string `json:"choices,omitempty"`
+}
+
+// SlashCommand creates a slash_command capability triggered by typing /command in the composer.
+func SlashCommand(command, description string, opts ...CapabilityOption) Capability {
+	c := Capability{Type: "slash_command", Title: "/" + command, Command: command, Description: description}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// ScheduledTask creates a scheduled_task capability run by the host on a cron schedule.
+// cronExpr uses the standard five-field syntax and is evaluated in UTC unless
+// WithTimezone is given, so "0 3 * * *" runs at 03:00 UTC by default.
+func ScheduledTask(name, cronExpr string, opts ...CapabilityOption) Capability {
+	c := Capability{Type: "scheduled_task", Title: name, Name: name, Cron: cronExpr}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// ReplyTemplates creates a reply_templates capability offering canned replies in the composer.
+func ReplyTemplates(title string, opts ...CapabilityOption) Capability {
+	c := Capability{Type: "reply_templates", Title: title}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// Reply is a canned reply offered by a ReplyTemplateProvider.
+type Reply struct {
+	Title   string   `json:"title"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
 // MCPToolParameter defines a parameter for an MCP tool.
 type MCPToolParameter struct {
 	Name        string   `json:"name"`
@@ -71,14 +239,77 @@ type MCPToolParameter struct {
 	Description string   `json:"description,omitempty"`
 	Required    bool     `json:"required"`
 	EnumValues  []string `json:"enum_values,omitempty"`
+	Default     any      `json:"default,omitempty"`
+	Minimum     *float64 `json:"minimum,omitempty"`    // For number
+	Maximum     *float64 `json:"maximum,omitempty"`    // For number
+	Pattern     string   `json:"pattern,omitempty"`    // For string, regular expression
+	MinLength   *int     `json:"min_length,omitempty"` // For string
+	MaxLength   *int     `json:"max_length,omitempty"` // For string
+
+	EnumOptions []EnumOption `json:"enum_options,omitempty"` // Labels of EnumValues, see ToolBuilder.EnumWithLabels
+}
+
+// EnumOption is an allowed value of an enum parameter with a human readable
+// label and an optional description helping the AI choose it.
+type EnumOption struct {
+	Value       string `json:"value"`
+	Label       string `json:"label"`
+	Description string `json:"description,omitempty"`
+}
+
+// ParamOption is a function to configure an MCPToolParameter.
+type ParamOption func(*MCPToolParameter)
+
+// ParamEnum sets the allowed values of an enum field created with ConfigField.
+func ParamEnum(values ...string) ParamOption {
+	return func(p *MCPToolParameter) { p.EnumValues = values }
+}
+
+// ParamDefault sets the value injected into args when the parameter is omitted.
+func ParamDefault(v any) ParamOption {
+	return func(p *MCPToolParameter) { p.Default = v }
+}
+
+// ParamMin sets the inclusive lower bound of a number parameter.
+func ParamMin(v float64) ParamOption {
+	return func(p *MCPToolParameter) { p.Minimum = &v }
+}
+
+// ParamMax sets the inclusive upper bound of a number parameter.
+func ParamMax(v float64) ParamOption {
+	return func(p *MCPToolParameter) { p.Maximum = &v }
+}
+
+// ParamPattern sets a regular expression a string parameter must match.
+func ParamPattern(re string) ParamOption {
+	return func(p *MCPToolParameter) { p.Pattern = re }
+}
+
+// ParamMinLength sets the minimum length of a string parameter.
+func ParamMinLength(n int) ParamOption {
+	return func(p *MCPToolParameter) { p.MinLength = &n }
+}
+
+// ParamMaxLength sets the maximum length of a string parameter.
+func ParamMaxLength(n int) ParamOption {
+	return func(p *MCPToolParameter) { p.MaxLength = &n }
 }
 
 // MCPToolDefinition defines an MCP tool provided by the plugin.
 type MCPToolDefinition struct {
-	Name        string             `json:"name"`
-	Title       string             `json:"title"`
-	Description string             `json:"description,omitempty"`
-	Parameters  []MCPToolParameter `json:"parameters"`
+	Name         string             `json:"name"`
+	Title        string             `json:"title"`
+	Description  string             `json:"description,omitempty"`
+	Parameters   []MCPToolParameter `json:"parameters"`
+	HistoryLimit int                `json:"history_limit,omitempty"` // Recent messages sent in ToolContext.Messages
+	Streaming    bool               `json:"streaming,omitempty"`     // Partial output is sent via ToolContext.Stream
+
+	MaxAttempts  int           `json:"-"` // Executions tried for RetryableError failures, see WithRetry
+	RetryBackoff time.Duration `json:"-"` // Delay before the first retry, doubled for each further one
+	Timeout      time.Duration `json:"-"` // Overrides Options.ToolTimeout, see ToolBuilder.Timeout
+	RateLimitN   int           `json:"-"` // Executions allowed per RateLimitPer, see ToolBuilder.RateLimit
+	RateLimitPer time.Duration `json:"-"`
+	PerVisitor   bool          `json:"-"` // Apply the rate limit to each visitor separately
 }
 
 // MCPTools creates an mcp_tools capability.
@@ -108,31 +339,97 @@ func (b *ToolBuilder) Description(d string) *ToolBuilder {
 	return b
 }
 
-func (b *ToolBuilder) String(name, desc string, required bool) *ToolBuilder {
-	b.def.Parameters = append(b.def.Parameters, MCPToolParameter{
-		Name: name, Type: "string", Description: desc, Required: required,
-	})
+// IncludeHistory asks the host to send up to limit recent session messages
+// in ToolContext.Messages when this tool is executed.
+func (b *ToolBuilder) IncludeHistory(limit int) *ToolBuilder {
+	b.def.HistoryLimit = limit
 	return b
 }
 
-func (b *ToolBuilder) Number(name, desc string, required bool) *ToolBuilder {
-	b.def.Parameters = append(b.def.Parameters, MCPToolParameter{
-		Name: name, Type: "number", Description: desc, Required: required,
-	})
+// WithRetry executes the tool up to maxAttempts times while OnToolExecute
+// returns a RetryableError, waiting backoff before the first retry and twice
+// as long before each further one. Retries stop early when the request
+// context is done or its deadline would pass while waiting.
+func (b *ToolBuilder) WithRetry(maxAttempts int, backoff time.Duration) *ToolBuilder {
+	b.def.MaxAttempts = maxAttempts
+	b.def.RetryBackoff = backoff
 	return b
 }
 
-func (b *ToolBuilder) Boolean(name, desc string, required bool) *ToolBuilder {
-	b.def.Parameters = append(b.def.Parameters, MCPToolParameter{
-		Name: name, Type: "boolean", Description: desc, Required: required,
-	})
+// Streaming lets the tool send partial output through ToolContext.Stream
+// while it runs. The stream is only set if the host speaks protocol version 3
+// or later; otherwise Emit is a no-op and only the final result is sent.
+func (b *ToolBuilder) Streaming() *ToolBuilder {
+	b.def.Streaming = true
+	return b
+}
+
+// RateLimit allows at most n executions of the tool per duration across all
+// visitors, with bursts up to n. Executions over the limit are answered with a
+// ToolResult with Error "rate limited" and Data {"retry_after_ms": <wait>}
+// without calling OnToolExecute. n and per must be positive, registration
+// fails otherwise.
+func (b *ToolBuilder) RateLimit(n int, per time.Duration) *ToolBuilder {
+	b.def.RateLimitN = n
+	b.def.RateLimitPer = per
 	return b
 }
 
-func (b *ToolBuilder) Enum(name, desc string, values []string, required bool) *ToolBuilder {
-	b.def.Parameters = append(b.def.Parameters, MCPToolParameter{
+// RateLimitPerVisitor is like RateLimit but counts executions of each visitor separately.
+func (b *ToolBuilder) RateLimitPerVisitor(n int, per time.Duration) *ToolBuilder {
+	b.RateLimit(n, per)
+	b.def.PerVisitor = true
+	return b
+}
+
+// Timeout overrides WithToolTimeout for this tool.
+func (b *ToolBuilder) Timeout(d time.Duration) *ToolBuilder {
+	b.def.Timeout = d
+	return b
+}
+
+func (b *ToolBuilder) String(name, desc string, required bool, opts ...ParamOption) *ToolBuilder {
+	return b.param(MCPToolParameter{
+		Name: name, Type: "string", Description: desc, Required: required,
+	}, opts)
+}
+
+func (b *ToolBuilder) Number(name, desc string, required bool, opts ...ParamOption) *ToolBuilder {
+	return b.param(MCPToolParameter{
+		Name: name, Type: "number", Description: desc, Required: required,
+	}, opts)
+}
+
+func (b *ToolBuilder) Boolean(name, desc string, required bool, opts ...ParamOption) *ToolBuilder {
+	return b.param(MCPToolParameter{
+		Name: name, Type: "boolean", Description: desc, Required: required,
+	}, opts)
+}
+
+func (b *ToolBuilder) Enum(name, desc string, values []string, required bool, opts ...ParamOption) *ToolBuilder {
+	return b.param(MCPToolParameter{
 		Name: name, Type: "enum", Description: desc, Required: required, EnumValues: values,
-	})
+	}, opts)
+}
+
+// EnumWithLabels adds an enum parameter whose values carry a label and
+// description, shown to the AI and in host rendered pickers. Arguments are
+// still the plain values, as with Enum.
+func (b *ToolBuilder) EnumWithLabels(name, desc string, options []EnumOption, required bool, opts ...ParamOption) *ToolBuilder {
+	values := make([]string, len(options))
+	for i, o := range options {
+		values[i] = o.Value
+	}
+	return b.param(MCPToolParameter{
+		Name: name, Type: "enum", Description: desc, Required: required, EnumValues: values, EnumOptions: options,
+	}, opts)
+}
+
+func (b *ToolBuilder) param(p MCPToolParameter, opts []ParamOption) *ToolBuilder {
+	for _, opt := range opts {
+		opt(&p)
+	}
+	b.def.Parameters = append(b.def.Parameters, p)
 	return b
 }
 
@@ -140,6 +437,62 @@ func (b *ToolBuilder) Build() MCPToolDefinition {
 	return b.def
 }
 
+// applyDefaults fills in declared defaults for parameters missing from args.
+func (d *MCPToolDefinition) applyDefaults(args map[string]any) {
+	for _, p := range d.Parameters {
+		if p.Default == nil {
+			continue
+		}
+		if _, ok := args[p.Name]; !ok {
+			args[p.Name] = p.Default
+		}
+	}
+}
+
+// validate checks args against the declared parameter constraints.
+func (d *MCPToolDefinition) validate(args map[string]any) error {
+	for _, p := range d.Parameters {
+		v, ok := args[p.Name]
+		if !ok || v == nil {
+			continue
+		}
+		if err := p.validate(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *MCPToolParameter) validate(v any) error {
+	if n, ok := v.(float64); ok {
+		if p.Minimum != nil && n < *p.Minimum {
+			return fmt.Errorf("parameter %q must be >= %v, got %v", p.Name, *p.Minimum, n)
+		}
+		if p.Maximum != nil && n > *p.Maximum {
+			return fmt.Errorf("parameter %q must be <= %v, got %v", p.Name, *p.Maximum, n)
+		}
+	}
+	if s, ok := v.(string); ok {
+		length := utf8.RuneCountInString(s)
+		if p.MinLength != nil && length < *p.MinLength {
+			return fmt.Errorf("parameter %q must be at least %d characters", p.Name, *p.MinLength)
+		}
+		if p.MaxLength != nil && length > *p.MaxLength {
+			return fmt.Errorf("parameter %q must be at most %d characters", p.Name, *p.MaxLength)
+		}
+		if p.Pattern != "" {
+			matched, err := regexp.MatchString(p.Pattern, s)
+			if err != nil {
+				return fmt.Errorf("parameter %q has invalid pattern: %w", p.Name, err)
+			}
+			if !matched {
+				return fmt.Errorf("parameter %q does not match pattern %s", p.Name, p.Pattern)
+			}
+		}
+	}
+	return nil
+}
+
 // Visitor contains information about a visitor.
 type Visitor struct {
 	ID             string         `json:"id"`
@@ -151,37 +504,323 @@ type Visitor struct {
 	Metadata       map[string]any `json:"metadata,omitempty"`
 }
 
+// Agent contains information about the agent the request is made for.
+type Agent struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Role   string `json:"role,omitempty"` // admin, agent
+	TeamID string `json:"team_id,omitempty"`
+}
+
+// IsAdmin reports whether the agent has the admin role. It is false for a nil Agent.
+func (a *Agent) IsAdmin() bool {
+	return a != nil && a.Role == "admin"
+}
+
+// Message is a message of a conversation.
+type Message struct {
+	ID        string    `json:"id,omitempty"`
+	Role      string    `json:"role"` // visitor, agent, ai, system
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
 // RenderContext is provided to render handlers.
 type RenderContext struct {
+	requestInfo
+
 	VisitorID string         `json:"visitor_id"`
 	SessionID string         `json:"session_id,omitempty"`
 	Visitor   *Visitor       `json:"visitor,omitempty"`
 	AgentID   string         `json:"agent_id,omitempty"`
+	Agent     *Agent         `json:"agent,omitempty"`
 	ActionID  string         `json:"action_id,omitempty"`
 	Language  string         `json:"language,omitempty"`
-	Context   map[string]any `json:"context"`
+	Context   Values         `json:"context"`
+	Settings  map[string]any `json:"settings,omitempty"` // Saved plugin settings, see SettingsHandler
+	Config    Values         `json:"config,omitempty"`   // Per-install capability config, see WithConfigSchema
+	Cursor    string         `json:"cursor,omitempty"`   // Page requested by the host, see Table.NextCursor
+	Host      *HostClient    `json:"-"`                  // Client for calling back into the host
+	i18n      *Bundle
 }
 
+// IsAdmin reports whether the requesting agent is an admin.
+func (c *RenderContext) IsAdmin() bool { return c.Agent.IsAdmin() }
+
 // EventContext is provided to event handlers.
 type EventContext struct {
+	requestInfo
+
 	EventType  string         `json:"event_type"`
 	ActionID   string         `json:"action_id"`
 	VisitorID  string         `json:"visitor_id,omitempty"`
 	SessionID  string         `json:"session_id,omitempty"`
+	Agent      *Agent         `json:"agent,omitempty"`
 	SelectedID string         `json:"selected_id,omitempty"`
 	Language   string         `json:"language,omitempty"`
-	FormData   map[string]any `json:"form_data,omitempty"`
-	Payload    map[string]any `json:"payload"`
+	FormData   Values         `json:"form_data,omitempty"`
+	Payload    Values         `json:"payload"`
+	Settings   map[string]any `json:"settings,omitempty"` // Saved plugin settings, see SettingsHandler
+	Config     Values         `json:"config,omitempty"`   // Per-install capability config, see WithConfigSchema
+	Host       *HostClient    `json:"-"`                  // Client for calling back into the host
+	i18n       *Bundle
+
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // Stable across retries, see ToolContext.IdempotencyKey
+}
+
+// IsAdmin reports whether the requesting agent is an admin.
+func (c *EventContext) IsAdmin() bool { return c.Agent.IsAdmin() }
+
+// Page returns the 1-based page requested by a page_change event of a
+// server-side Table, read from the "page" payload key. It is 1 if absent.
+func (c *EventContext) Page() int {
+	if page, ok := c.Payload.IntOK("page"); ok && page > 0 {
+		return page
+	}
+	return 1
+}
+
+// PageSize returns the rows per page of a page_change event, read from the
+// "page_size" payload key, or 0 if absent.
+func (c *EventContext) PageSize() int {
+	return c.Payload.Int("page_size")
+}
+
+// Cursor returns the "cursor" payload key of events continuing a cursor
+// paginated list. Tables using Table.NextCursor receive the cursor as
+// RenderContext.Cursor instead.
+func (c *EventContext) Cursor() string {
+	return c.Payload.String("cursor")
+}
+
+// SortBy returns the column key of a server-side Table the agent sorted by,
+// from the "sort_by" payload key, and whether the order is descending, i.e.
+// "sort_order" is "desc". The column is empty if the table is unsorted.
+func (c *EventContext) SortBy() (string, bool) {
+	return c.Payload.String("sort_by"), c.Payload.String("sort_order") == "desc"
+}
+
+// BindForm decodes the submitted form data into v, a pointer to a struct,
+// matching fields by their json tags. Fields missing from the form keep
+// their value; a value of the wrong type, e.g. text for an int field, is an
+// error naming the field.
+func (c *EventContext) BindForm(v any) error {
+	data, err := json.Marshal(c.FormData)
+	if err != nil {
+		return fmt.Errorf("invalid form data: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return fmt.Errorf("form field %q: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return fmt.Errorf("invalid form data: %w", err)
+	}
+	return nil
+}
+
+// StringSlice returns the values of a checkbox_group field in form data.
+// A single string is returned as a one-element slice, non-string values are
+// skipped and a missing field yields nil.
+func StringSlice(fd map[string]any, name string) []string {
+	switch v := fd[name].(type) {
+	case []string:
+		return v
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	}
+	return nil
+}
+
+// FormFloat returns the value of a number field in form data. Numeric
+// strings are accepted as well, except NaN and infinities.
+func FormFloat(fd map[string]any, name string) (float64, error) {
+	switch v := fd[name].(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		if v == "" {
+			break
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, fmt.Errorf("form field %q: invalid number %q", name, v)
+		}
+		return f, nil
+	case nil:
+	default:
+		return 0, fmt.Errorf("form field %q: expected number, got %T", name, v)
+	}
+	return 0, fmt.Errorf("form field %q is missing", name)
+}
+
+// FormInt returns the value of a number field in form data as an int.
+// It fails if the value has a fractional part or does not fit an int.
+func FormInt(fd map[string]any, name string) (int, error) {
+	f, err := FormFloat(fd, name)
+	if err != nil {
+		return 0, err
+	}
+	if f != math.Trunc(f) || f < math.MinInt || f >= math.MaxInt {
+		return 0, fmt.Errorf("form field %q: %v is not a valid int", name, f)
+	}
+	return int(f), nil
+}
+
+// FormTime parses the value of a date, datetime or time field in form data.
+// Values are submitted as RFC3339; plain dates (2006-01-02) and times
+// (15:04 or 15:04:05) are accepted as well.
+func FormTime(fd map[string]any, name string) (time.Time, error) {
+	s, ok := fd[name].(string)
+	if !ok || s == "" {
+		return time.Time{}, fmt.Errorf("form field %q is missing", name)
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly, time.TimeOnly, "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("form field %q: invalid time %q", name, s)
 }
 
 // ToolContext is provided to MCP tool execution handlers.
 type ToolContext struct {
+	requestInfo
+
 	VisitorID string         `json:"visitor_id"`
 	SessionID string         `json:"session_id,omitempty"`
 	Visitor   *Visitor       `json:"visitor,omitempty"`
 	AgentID   string         `json:"agent_id,omitempty"`
+	Agent     *Agent         `json:"agent,omitempty"`
 	Language  string         `json:"language,omitempty"`
-	Context   map[string]any `json:"context,omitempty"`
+	Context   Values         `json:"context,omitempty"`
+	Messages  []Message      `json:"messages,omitempty"` // Only for tools declared with IncludeHistory
+	DryRun    bool           `json:"dry_run,omitempty"`  // Validate only: return the would-be result without side effects
+	Settings  map[string]any `json:"settings,omitempty"` // Saved plugin settings, see SettingsHandler
+	Host      *HostClient    `json:"-"`                  // Client for calling back into the host
+	Stream    *ToolStream    `json:"-"`                  // Set for streaming tools, see ToolBuilder.Streaming
+	i18n      *Bundle
+
+	// IdempotencyKey is the same for every attempt of one logical operation:
+	// the host sends a stable key when it retries a request, e.g. after a
+	// timeout. Handlers with side effects can dedupe on it, or let the SDK
+	// do so with WithIdempotency.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// IsAdmin reports whether the requesting agent is an admin.
+func (c *ToolContext) IsAdmin() bool { return c.Agent.IsAdmin() }
+
+// WebhookContext is provided to webhook handlers and describes the incoming HTTP request.
+type WebhookContext struct {
+	requestInfo
+
+	Path     string              `json:"path"`
+	Method   string              `json:"method"`
+	Headers  map[string]string   `json:"headers,omitempty"`
+	Query    map[string][]string `json:"query,omitempty"`
+	Body     string              `json:"body,omitempty"` // Raw request body
+	Settings map[string]any      `json:"settings,omitempty"`
+	Host     *HostClient         `json:"-"` // Client for calling back into the host
+}
+
+// BindJSON decodes the request body as JSON into v.
+func (c *WebhookContext) BindJSON(v any) error {
+	return json.Unmarshal([]byte(c.Body), v)
+}
+
+// WebhookResponse is the HTTP response returned to the webhook caller. The
+// host forwards Status, Headers and Body as they are. A nil response or a
+// zero Status is sent as 200 OK.
+type WebhookResponse struct {
+	Status  int               `json:"status"` // Defaults to 200 when zero
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    []byte            `json:"-"` // See MarshalJSON
+
+	ContentType string `json:"content_type,omitempty"` // Sent as the Content-Type header unless Headers sets one
+}
+
+// MarshalJSON sends Body as text in "body" when it is valid UTF-8 and base64
+// encoded in "body_base64" otherwise, e.g. for images, so binary payloads
+// reach the caller unchanged.
+func (r WebhookResponse) MarshalJSON() ([]byte, error) {
+	type response WebhookResponse
+	out := struct {
+		response
+		Body       string `json:"body,omitempty"`
+		BodyBase64 string `json:"body_base64,omitempty"`
+	}{response: response(r)}
+	if utf8.Valid(r.Body) {
+		out.Body = string(r.Body)
+	} else {
+		out.BodyBase64 = base64.StdEncoding.EncodeToString(r.Body)
+	}
+	return json.Marshal(out)
+}
+
+// OK responds to a webhook with 200 and a plain text body.
+func OK(body []byte) *WebhookResponse {
+	return &WebhookResponse{Status: 200, Body: body, ContentType: "text/plain; charset=utf-8"}
+}
+
+// JSON responds to a webhook with 200 and v encoded as JSON, or with 500 if
+// v cannot be encoded.
+func JSON(v any) *WebhookResponse {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return &WebhookResponse{Status: 500, Body: []byte("failed to encode response"), ContentType: "text/plain; charset=utf-8"}
+	}
+	return &WebhookResponse{Status: 200, Body: data, ContentType: "application/json"}
+}
+
+// Unauthorized responds to a webhook with 401, e.g. when the caller's
+// signature or token header does not match.
+func Unauthorized() *WebhookResponse {
+	return &WebhookResponse{Status: 401, Body: []byte("unauthorized"), ContentType: "text/plain; charset=utf-8"}
+}
+
+// TaskContext is provided to scheduled task handlers.
+type TaskContext struct {
+	requestInfo
+
+	TaskName    string         `json:"task_name"`
+	RunID       string         `json:"run_id"`       // Stable across retries of the same run, use it for idempotency
+	ScheduledAt time.Time      `json:"scheduled_at"` // The tick this run was scheduled for
+	Settings    map[string]any `json:"settings,omitempty"`
+	Host        *HostClient    `json:"-"` // Client for calling back into the host
+}
+
+// ChannelContext is provided to channel message handlers for a message a
+// visitor sent through an external channel such as WhatsApp.
+type ChannelContext struct {
+	requestInfo
+
+	ChannelID      string         `json:"channel_id"`       // Channel installation the message arrived on
+	ExternalUserID string         `json:"external_user_id"` // Sender id on the external platform, e.g. a phone number
+	MessageID      string         `json:"message_id,omitempty"`
+	Content        string         `json:"content"`
+	ContentType    string         `json:"content_type,omitempty"` // text (default), image, file
+	Payload        Values         `json:"payload,omitempty"`      // Raw message as delivered by the external platform
+	Settings       map[string]any `json:"settings,omitempty"`
+	Host           *HostClient    `json:"-"` // Client for calling back into the host
 }
 
 // ToolResult is the result of an MCP tool execution.
@@ -190,4 +829,60 @@ type ToolResult struct {
 	Content string         `json:"content"`         // Text result for the AI
 	Data    map[string]any `json:"data,omitempty"`  // Structured data (optional)
 	Error   string         `json:"error,omitempty"` // Error message if success is false
+
+	Attachments []Attachment `json:"attachments,omitempty"` // Files offered to the agent for download
+}
+
+// NewToolResult creates a successful result with content for the AI.
+func NewToolResult(content string) *ToolResult {
+	return &ToolResult{Success: true, Content: content}
+}
+
+// WithData sets the structured data of the result.
+func (r *ToolResult) WithData(data map[string]any) *ToolResult {
+	r.Data = data
+	return r
+}
+
+// Fail marks the result as failed with errMsg. Content is set to errMsg too
+// if empty, so the AI learns why the tool failed.
+func (r *ToolResult) Fail(errMsg string) *ToolResult {
+	r.Success = false
+	r.Error = errMsg
+	if r.Content == "" {
+		r.Content = errMsg
+	}
+	return r
+}
+
+// Ok marks the result as successful, clearing an error set by Fail.
+func (r *ToolResult) Ok() *ToolResult {
+	r.Success = true
+	r.Error = ""
+	return r
+}
+
+// Attachment is a file returned by a tool, either inline as base64 or by URL.
+// Inline data is meant for small files: keep it below 1 MB, as the whole
+// result travels in one message. Prefer a URL for anything larger, e.g. a
+// signed link to object storage.
+type Attachment struct {
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type"`
+	Base64   string `json:"base64,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// AddAttachment attaches data inline, base64 encoded.
+func (r *ToolResult) AddAttachment(filename, mimeType string, data []byte) *ToolResult {
+	r.Attachments = append(r.Attachments, Attachment{
+		Filename: filename, MimeType: mimeType, Base64: base64.StdEncoding.EncodeToString(data),
+	})
+	return r
+}
+
+// AddAttachmentURL attaches a file the host downloads from url.
+func (r *ToolResult) AddAttachmentURL(filename, mimeType, url string) *ToolResult {
+	r.Attachments = append(r.Attachments, Attachment{Filename: filename, MimeType: mimeType, URL: url})
+	return r
 }
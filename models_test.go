@@ -0,0 +1,190 @@
+package tgo_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tgoai/tgo-plugin-go"
+	"github.com/tgoai/tgo-plugin-go/tgotest"
+)
+
+type webhookPlugin struct{ tgo.BasePlugin }
+
+func (p *webhookPlugin) OnWebhook(ctx *tgo.WebhookContext) *tgo.WebhookResponse {
+	switch ctx.Path {
+	case "/ok":
+		return tgo.OK([]byte("received"))
+	case "/json":
+		return tgo.JSON(map[string]any{"id": 1})
+	case "/unauthorized":
+		return tgo.Unauthorized()
+	case "/image":
+		return &tgo.WebhookResponse{Body: []byte{0x89, 'P', 'N', 'G', 0xff}, ContentType: "image/png"}
+	}
+	return nil
+}
+
+func TestWebhookResponses(t *testing.T) {
+	h, err := tgotest.New(&webhookPlugin{BasePlugin: tgo.BasePlugin{PID: "hook", PName: "Hook", PVersion: "1.0.0", Caps: []tgo.Capability{tgo.Webhook("/hook")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	tests := []struct {
+		path string
+		want map[string]any
+	}{
+		{"/ok", map[string]any{"status": 200.0, "body": "received", "content_type": "text/plain; charset=utf-8"}},
+		{"/json", map[string]any{"status": 200.0, "body": `{"id":1}`, "content_type": "application/json"}},
+		{"/unauthorized", map[string]any{"status": 401.0, "body": "unauthorized", "content_type": "text/plain; charset=utf-8"}},
+		{"/image", map[string]any{"status": 200.0, "body_base64": "iVBOR/8=", "content_type": "image/png"}},
+		{"/nil", map[string]any{"status": 200.0}},
+	}
+	for _, tt := range tests {
+		got, err := h.Call("webhook/invoke", &tgo.WebhookContext{Path: tt.path, Method: "POST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.path, got, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("%s: got %v, want %v", tt.path, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestStringSlice(t *testing.T) {
+	fd := map[string]any{
+		"tags":   []any{"bug", "ui"},
+		"typed":  []string{"a"},
+		"mixed":  []any{"bug", 1.0, nil, "ui"},
+		"single": "bug",
+		"blank":  "",
+		"none":   []any{},
+		"number": 3.0,
+	}
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"tags", []string{"bug", "ui"}},
+		{"typed", []string{"a"}},
+		{"mixed", []string{"bug", "ui"}},
+		{"single", []string{"bug"}},
+		{"blank", nil},
+		{"none", []string{}},
+		{"number", nil},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		if got := tgo.StringSlice(fd, tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+	if got := tgo.StringSlice(nil, "tags"); got != nil {
+		t.Errorf("nil form data: got %#v", got)
+	}
+}
+
+func TestFormNumbers(t *testing.T) {
+	fd := map[string]any{
+		"whole":    42.0,
+		"fraction": 19.99,
+		"negative": -3.0,
+		"int":      7,
+		"number":   json.Number("12"),
+		"string":   " 5",
+		"numeric":  "5.5",
+		"blank":    "",
+		"nan":      "NaN",
+		"inf":      "Inf",
+		"huge":     1e300,
+		"bool":     true,
+		"null":     nil,
+	}
+	tests := []struct {
+		name  string
+		float float64 // Ignored when fErr
+		fErr  bool
+		int   int
+		iErr  bool
+	}{
+		{name: "whole", float: 42, int: 42},
+		{name: "fraction", float: 19.99, iErr: true},
+		{name: "negative", float: -3, int: -3},
+		{name: "int", float: 7, int: 7},
+		{name: "number", float: 12, int: 12},
+		{name: "string", fErr: true, iErr: true},
+		{name: "numeric", float: 5.5, iErr: true},
+		{name: "blank", fErr: true, iErr: true},
+		{name: "nan", fErr: true, iErr: true},
+		{name: "inf", fErr: true, iErr: true},
+		{name: "huge", float: 1e300, iErr: true},
+		{name: "bool", fErr: true, iErr: true},
+		{name: "null", fErr: true, iErr: true},
+		{name: "missing", fErr: true, iErr: true},
+	}
+	for _, tt := range tests {
+		f, err := tgo.FormFloat(fd, tt.name)
+		if (err != nil) != tt.fErr || (err == nil && f != tt.float) {
+			t.Errorf("FormFloat(%s) = %v, %v", tt.name, f, err)
+		}
+		i, err := tgo.FormInt(fd, tt.name)
+		if (err != nil) != tt.iErr || (err == nil && i != tt.int) {
+			t.Errorf("FormInt(%s) = %v, %v", tt.name, i, err)
+		}
+	}
+}
+
+type createTicketRequest struct {
+	Title    string   `json:"title"`
+	Priority int      `json:"priority"`
+	Amount   float64  `json:"amount"`
+	Tags     []string `json:"tags"`
+}
+
+func TestBindForm(t *testing.T) {
+	ctx := &tgo.EventContext{FormData: map[string]any{"title": "Login fails", "priority": 2.0, "tags": []any{"bug"}, "extra": true}}
+	req := createTicketRequest{Amount: 9.5} // Missing fields keep their value
+	if err := ctx.BindForm(&req); err != nil {
+		t.Fatal(err)
+	}
+	want := createTicketRequest{Title: "Login fails", Priority: 2, Amount: 9.5, Tags: []string{"bug"}}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("got %+v, want %+v", req, want)
+	}
+
+	var empty createTicketRequest
+	if err := (&tgo.EventContext{}).BindForm(&empty); err != nil || !reflect.DeepEqual(empty, createTicketRequest{}) {
+		t.Errorf("no form data: got %+v, %v", empty, err)
+	}
+
+	tests := []struct {
+		name  string
+		data  map[string]any
+		field string
+	}{
+		{"text for int", map[string]any{"priority": "high"}, `"priority"`},
+		{"fraction for int", map[string]any{"priority": 1.5}, `"priority"`},
+		{"number for string", map[string]any{"title": 7.0}, `"title"`},
+		{"string for list", map[string]any{"tags": "bug"}, `"tags"`},
+	}
+	for _, tt := range tests {
+		var req createTicketRequest
+		err := (&tgo.EventContext{FormData: tt.data}).BindForm(&req)
+		if err == nil || !strings.Contains(err.Error(), tt.field) {
+			t.Errorf("%s: got %v, want an error naming %s", tt.name, err, tt.field)
+		}
+	}
+	if err := ctx.BindForm(createTicketRequest{}); err == nil {
+		t.Error("binding into a non-pointer succeeded")
+	}
+}
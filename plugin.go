@@ -1,12 +1,14 @@
 package tgo
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 // Plugin is the interface that all TGO plugins must implement.
@@ -40,13 +42,120 @@ type ToolHandler interface {
 	OnToolExecute(ctx *ToolContext, toolName string, args map[string]any) (*ToolResult, error)
 }
 
+// DashboardWidgetRenderer renders a dashboard widget. The widget is not tied to
+// a conversation, so VisitorID, SessionID and Visitor are empty in ctx.
+type DashboardWidgetRenderer interface {
+	OnDashboardRender(ctx *RenderContext) Template
+}
+
+// SettingsRenderer renders the plugin settings page, typically as a Form.
+type SettingsRenderer interface {
+	OnSettingsRender(ctx *RenderContext) Template
+}
+
+// SettingsHandler handles a settings page submission. The submitted values
+// arrive in ctx.FormData; the host persists them per plugin installation and
+// passes the latest saved values back as Settings on every subsequent
+// RenderContext, EventContext and ToolContext.
+type SettingsHandler interface {
+	OnSettingsSave(ctx *EventContext) *Action
+}
+
+// WebhookHandler handles HTTP requests forwarded by the host to a declared Webhook path.
+type WebhookHandler interface {
+	OnWebhook(ctx *WebhookContext) *WebhookResponse
+}
+
+// SlashCommandHandler handles a slash command typed by an agent. ctx.ActionID
+// is the command name and ctx.Payload carries the parsed arguments by name.
+type SlashCommandHandler interface {
+	OnSlashCommand(ctx *EventContext) *Action
+}
+
+// ScheduledTaskHandler runs a scheduled task. Returning an error marks the run as failed.
+type ScheduledTaskHandler interface {
+	OnScheduledTask(ctx *TaskContext) error
+}
+
+// Starter is invoked by Run before connecting to the host. A non-nil error aborts Run.
+type Starter interface {
+	OnStart() error
+}
+
+// Stopper is invoked by Run when it returns after a successful OnStart, whether
+// the connection was lost or a shutdown was requested. Handlers still running
+// by then have finished.
+type Stopper interface {
+	OnStop()
+}
+
+// RegisteredHandler is invoked with the host's registration result once registration succeeds.
+type RegisteredHandler interface {
+	OnRegistered(result map[string]any)
+}
+
+// HealthReporter adds plugin specific details, e.g. the state of a database
+// connection, to the reply to the host's health request. A non-nil error
+// reports the plugin as unhealthy. It should return quickly.
+type HealthReporter interface {
+	OnHealth() (map[string]any, error)
+}
+
+// ReplyTemplateProvider lists canned replies for the composer, e.g. in
+// ctx.Language. Selecting one inserts its Content as with InsertText.
+type ReplyTemplateProvider interface {
+	OnReplyTemplates(ctx *RenderContext) []Reply
+}
+
+// ChannelMessageHandler receives inbound messages of a channel integration,
+// see ChannelIntegrationManifestProvider. Returning an error makes the host
+// retry delivery. Replies are sent with ctx.Host.SendChannelMessage.
+type ChannelMessageHandler interface {
+	OnChannelMessageReceive(ctx *ChannelContext) error
+}
+
 // Options for running a plugin.
 type Options struct {
 	SocketPath string
 	TCPAddr    string
 	DevToken   string
+	Logger     Logger
+	Middleware []Middleware
+	Transport  *Transport // Overrides SocketPath and TCPAddr when set
+	I18n       *Bundle    // Translations used by the T method of contexts
+	Metrics    MetricsHook
+
+	MaxConcurrency int  // Maximum handlers running at once, 0 means unlimited
+	RejectWhenBusy bool // Reject requests over MaxConcurrency instead of queueing them
+
+	Compression int // Minimum payload size to gzip once the host agrees, 0 disables it
+
+	ToolTimeout  time.Duration // Deadline for OnToolExecute, 0 means none
+	ReadTimeout  time.Duration // Maximum silence from the host before the connection counts as lost
+	WriteTimeout time.Duration // Maximum time to write one message before the connection counts as lost
+
+	WebSocketURL string      // ws:// or wss:// gateway, overrides SocketPath and TCPAddr
+	TLSConfig    *tls.Config // Used to dial wss:// URLs
+
+	MinProtocolVersion int // Registration fails if the host speaks an older protocol
+
+	InitializeResult func(result map[string]any) // Adjusts the reply to the host's initialize request
+
+	EscapeHTML bool  // Escape <, > and & in JSON sent to the host
+	Codec      Codec // Offered to the host at registration, JSON is used if it declines
+
+	OnConnect    func()          // Called once the connection to the host is established
+	OnDisconnect func(err error) // Called after the connection is closed, err is nil on shutdown
+
+	IdempotencyTTL time.Duration // How long responses are replayed for repeated idempotency keys, 0 disables it
 }
 
+// ProtocolVersion is the protocol version spoken by this SDK. Version 1 is
+// the original protocol of hosts that do not report a version; version 2 adds
+// gzip compression, version 3 streaming tool results and version 4 codecs
+// other than JSON.
+const ProtocolVersion = 4
+
 type Option func(*Options)
 
 func WithSocketPath(path string) Option {
@@ -61,203 +170,623 @@ func WithDevToken(token string) Option {
 	return func(o *Options) { o.DevToken = token }
 }
 
-// Run starts the plugin and handles communication with TGO.
+// WithWebSocket makes Run connect to the host through a WebSocket gateway.
+func WithWebSocket(url string) Option {
+	return func(o *Options) { o.WebSocketURL = url }
+}
+
+// WithTLSConfig sets the TLS configuration for wss:// connections.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *Options) { o.TLSConfig = cfg }
+}
+
+// WithTransport makes Run use t instead of dialing SocketPath or TCPAddr.
+func WithTransport(t *Transport) Option {
+	return func(o *Options) { o.Transport = t }
+}
+
+// WithMaxConcurrency limits how many handlers run simultaneously. Excess
+// requests wait for a free slot unless WithRejectWhenBusy is set.
+// ping and shutdown are never limited.
+func WithMaxConcurrency(n int) Option {
+	return func(o *Options) { o.MaxConcurrency = n }
+}
+
+// WithRejectWhenBusy makes requests over MaxConcurrency fail immediately with a busy error.
+func WithRejectWhenBusy(reject bool) Option {
+	return func(o *Options) { o.RejectWhenBusy = reject }
+}
+
+// WithToolTimeout limits how long OnToolExecute may run. When d elapses the
+// host receives a ToolResult with Error "timeout" and the request context
+// (ToolContext.RequestContext) is cancelled. The handler goroutine keeps running
+// unless it returns once the context is done. Tools may override d with
+// ToolBuilder.Timeout.
+func WithToolTimeout(d time.Duration) Option {
+	return func(o *Options) { o.ToolTimeout = d }
+}
+
+// WithReadTimeout makes Run return a timeout TransportError when the host
+// sends nothing for d, detecting half-open connections. Every frame, including
+// the host's pings, restarts the timer, so d should span several ping intervals.
+// Callers may reconnect by calling Run again.
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *Options) { o.ReadTimeout = d }
+}
+
+// WithIdempotency makes the SDK answer a request whose idempotency key was
+// already seen within ttl with the response of the first request, without
+// calling the handler again. A duplicate arriving while the first is still
+// running waits for it. Error responses and failed tool results, e.g. a
+// timeout or rate limiting, are not replayed, so a retry runs again. Keys
+// are scoped to the method and kept in memory, so they do not survive a
+// restart. See ToolContext.IdempotencyKey.
+func WithIdempotency(ttl time.Duration) Option {
+	return func(o *Options) { o.IdempotencyTTL = ttl }
+}
+
+// WithWriteTimeout bounds how long writing a single message to the host may
+// take. A host that stops reading would otherwise block every handler trying
+// to respond. On timeout the connection is closed and Run returns with the
+// resulting read error; callers may reconnect by calling Run again.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *Options) { o.WriteTimeout = d }
+}
+
+// WithMinProtocolVersion makes Run fail with ErrUnsupportedProtocol when the
+// host's protocol version is below v.
+func WithMinProtocolVersion(v int) Option {
+	return func(o *Options) { o.MinProtocolVersion = v }
+}
+
+// WithCompression offers gzip compression to the host at registration.
+// If the host accepts, payloads of at least minSize bytes are compressed.
+func WithCompression(minSize int) Option {
+	return func(o *Options) { o.Compression = minSize }
+}
+
+// WithInitializeResult sets fn to adjust the reply to the host's initialize
+// request, e.g. to add or rename fields for a particular host. fn receives the
+// default result built by the SDK and may modify it in place.
+func WithInitializeResult(fn func(result map[string]any)) Option {
+	return func(o *Options) { o.InitializeResult = fn }
+}
+
+// WithOnConnect sets fn to be called by Run once it is connected to the host,
+// before registration. Together with WithOnDisconnect it lets monitoring
+// track uptime across restarts of Run.
+func WithOnConnect(fn func()) Option {
+	return func(o *Options) { o.OnConnect = fn }
+}
+
+// WithOnDisconnect sets fn to be called when Run closes the connection it
+// connected, with the error that ended it, or nil after a requested shutdown.
+// The transport is closed by then, so fn may safely use it, e.g. to read Stats.
+func WithOnDisconnect(fn func(err error)) Option {
+	return func(o *Options) { o.OnDisconnect = fn }
+}
+
+// WithCodec offers c, e.g. MsgpackCodec, to the host at registration. If the
+// host accepts, all messages after the registration reply are encoded with c
+// instead of JSON. It has no effect over WebSocket.
+func WithCodec(c Codec) Option {
+	return func(o *Options) { o.Codec = c }
+}
+
+// WithEscapeHTML turns on json.Marshal style escaping of <, > and & in
+// messages sent to the host, for hosts that embed them in HTML unescaped.
+func WithEscapeHTML(on bool) Option {
+	return func(o *Options) { o.EscapeHTML = on }
+}
+
+// WithMiddleware appends middleware wrapping every handler dispatch.
+// The first middleware given is the outermost.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(o *Options) { o.Middleware = append(o.Middleware, mw...) }
+}
+
+// WithI18n sets the translation bundle behind RenderContext.T, EventContext.T and ToolContext.T.
+func WithI18n(b *Bundle) Option {
+	return func(o *Options) { o.I18n = b }
+}
+
+// WithMetrics reports every handled request to hook.
+func WithMetrics(hook MetricsHook) Option {
+	return func(o *Options) { o.Metrics = hook }
+}
+
+// WithLogger replaces the default stdlib-backed logger.
+func WithLogger(l Logger) Option {
+	return func(o *Options) { o.Logger = l }
+}
+
+// Run starts the plugin and handles communication with TGO until the
+// connection is lost, the host requests shutdown or SIGINT or SIGTERM is received.
 func Run(p Plugin, opts ...Option) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return RunContext(ctx, p, opts...)
+}
+
+// RunContext is like Run without signal handling: it returns nil after a
+// graceful drain of in-flight requests once ctx is cancelled, also while
+// still registering with the host.
+func RunContext(ctx context.Context, p Plugin, opts ...Option) (err error) {
 	options := &Options{
 		SocketPath: "/var/run/tgo/tgo.sock",
+		Logger:     NewStdLogger(false),
 	}
 	for _, opt := range opts {
 		opt(options)
 	}
 
-	var transport *Transport
-	if options.TCPAddr != "" {
+	if h, ok := p.(Starter); ok {
+		if err := h.OnStart(); err != nil {
+			return fmt.Errorf("plugin start failed: %w", err)
+		}
+	}
+	if h, ok := p.(Stopper); ok {
+		defer h.OnStop()
+	}
+
+	transport := options.Transport
+	if transport == nil && options.WebSocketURL != "" {
+		transport = NewWebSocketTransport(options.WebSocketURL)
+		transport.SetTLSConfig(options.TLSConfig)
+	} else if transport == nil && options.TCPAddr != "" {
 		transport = NewTCPTransport(options.TCPAddr)
-	} else {
+	} else if transport == nil {
 		transport = NewUnixTransport(options.SocketPath)
 	}
 
 	if err := transport.Connect(); err != nil {
 		return err
 	}
-	defer transport.Close()
-
-	// Handle signals for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Register the plugin
-	if err := register(p, transport, options.DevToken); err != nil {
+	if options.OnConnect != nil {
+		options.OnConnect()
+	}
+	defer func() {
+		transport.Close()
+		if options.OnDisconnect != nil {
+			options.OnDisconnect(err)
+		}
+	}()
+	transport.SetReadTimeout(options.ReadTimeout)
+	transport.SetWriteTimeout(options.WriteTimeout)
+	transport.SetEscapeHTML(options.EscapeHTML)
+
+	srv := newServer(p, transport, options)
+
+	// Register the plugin. The handshake reads and writes synchronously, so
+	// cancelling ctx interrupts the connection to end it.
+	stop := context.AfterFunc(ctx, transport.interrupt)
+	regResult, err := register(srv)
+	if !stop() {
+		options.Logger.Info("context done during registration, shutting down", "cause", context.Cause(ctx))
+		return nil
+	}
+	if err != nil {
 		return fmt.Errorf("registration failed: %w", err)
 	}
+	if h, ok := p.(RegisteredHandler); ok {
+		h.OnRegistered(regResult)
+	}
 
-	log.Printf("Plugin '%s' v%s is running", p.Name(), p.Version())
+	options.Logger.Info("plugin is running", "name", p.Name(), "version", p.Version())
 
 	// Main request loop
+	if enabled, ok := regResult["enabled"].(map[string]any); ok {
+		srv.enabled.update(enabled)
+	}
 	done := make(chan error, 1)
 	go func() {
-		for {
-			msg, err := transport.RecvMessage()
-			if err != nil {
-				done <- err
-				return
-			}
-
-			go handleRequest(p, transport, msg)
-		}
+		done <- transport.Serve(func(msg map[string]any) {
+			srv.startRequest(msg, func() { srv.handleRequest(msg) })
+		}, func(batch []map[string]any) {
+			srv.startBatch(batch)
+		})
 	}()
 
+	var serveErr error
 	select {
-	case err := <-done:
-		log.Printf("Connection lost: %v", err)
-		return err
-	case sig := <-sigChan:
-		log.Printf("Received signal %v, shutting down...", sig)
-		return nil
+	case serveErr = <-done:
+		var terr *TransportError
+		if errors.As(serveErr, &terr) && terr.Timeout() {
+			options.Logger.Error("connection lost, host silent for too long", "timeout", options.ReadTimeout)
+		} else {
+			options.Logger.Error("connection lost", "error", serveErr)
+		}
+	case <-ctx.Done():
+		options.Logger.Info("context done, shutting down", "cause", context.Cause(ctx))
+	case <-srv.shutdown:
+		options.Logger.Info("received shutdown request, shutting down")
 	}
+	// Handlers must be done before OnStop, even when the connection is lost.
+	// Calls to the host fail right away once Serve has returned.
+	srv.drain()
+	return serveErr
 }
 
-func register(p Plugin, t *Transport, devToken string) error {
+// registerID is the id of the register request, plugin-initiated Calls use
+// ids above it.
+const registerID = 1
+
+func register(srv *server) (map[string]any, error) {
+	p, t, options := srv.p, srv.t, srv.options
+	if err := validateCapabilities(p.Capabilities()); err != nil {
+		return nil, fmt.Errorf("invalid capabilities: %w", err)
+	}
+	options.Logger.Debug("registering plugin", "id", p.ID(), "capabilities", len(p.Capabilities()))
+
+	params := manifest(p)
+	params["dev_token"] = options.DevToken
+	if options.Compression > 0 {
+		params["compression"] = []string{"gzip"}
+	}
+	// WebSocket frames have no room to flag a binary codec.
+	offerCodec := options.Codec != nil && !t.isWebSocket()
+	if offerCodec {
+		params["codecs"] = []string{options.Codec.Name(), "json"}
+	}
 	req := map[string]any{
 		"jsonrpc": "2.0",
-		"id":      1,
+		"id":      registerID,
 		"method":  "register",
-		"params": map[string]any{
-			"id":           p.ID(),
-			"name":         p.Name(),
-			"version":      p.Version(),
-			"capabilities": p.Capabilities(),
-			"dev_token":    devToken,
-		},
+		"params":  params,
 	}
 
 	if err := t.SendMessage(req); err != nil {
-		return err
+		return nil, err
 	}
 
-	resp, err := t.RecvMessage()
+	resp, err := awaitRegistration(srv)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	result, ok := resp["result"].(map[string]any)
 	if !ok || result["success"] != true {
-		return fmt.Errorf("registration failed: %v", resp["error"])
+		return nil, fmt.Errorf("%w: %v", ErrRegistrationRejected, resp["error"])
 	}
 
-	return nil
-}
-
-func handleRequest(p Plugin, t *Transport, msg map[string]any) {
-	method, _ := msg["method"].(string)
-	id, _ := msg["id"]
-	params, _ := msg["params"].(map[string]any)
-
-	if method == "" {
-		return
+	// Hosts predating versioning leave the field out and speak version 1.
+	hostVersion := 1
+	if v, ok := result["protocol_version"].(float64); ok {
+		hostVersion = int(v)
 	}
-
-	if method == "shutdown" {
-		t.SendMessage(map[string]any{
-			"jsonrpc": "2.0",
-			"id":      id,
-			"result":  map[string]any{"success": true},
-		})
-		return
+	if hostVersion < options.MinProtocolVersion {
+		return nil, fmt.Errorf("%w: host speaks %d, plugin requires at least %d", ErrUnsupportedProtocol, hostVersion, options.MinProtocolVersion)
+	}
+	version := min(hostVersion, ProtocolVersion)
+	t.SetProtocolVersion(version)
+	options.Logger.Debug("protocol negotiated", "version", version)
+
+	// Hosts without compression support leave the field out.
+	if version >= 2 && options.Compression > 0 && result["compression"] == "gzip" {
+		t.SetCompression(options.Compression)
+		options.Logger.Debug("gzip compression enabled", "min_size", options.Compression)
 	}
 
-	if method == "ping" {
-		t.SendMessage(map[string]any{
-			"jsonrpc": "2.0",
-			"id":      id,
-			"result":  map[string]any{"pong": true},
-		})
-		return
+	// The host names the codec it switched to, JSON if none.
+	if version >= 4 && offerCodec && result["codec"] == options.Codec.Name() {
+		t.SetCodec(options.Codec)
+		options.Logger.Debug("codec negotiated", "codec", options.Codec.Name())
 	}
 
-	var result any
-	var err error
+	return result, nil
+}
+
+// awaitRegistration reads messages until the reply to the register request.
+// Hosts using an MCP-style handshake send initialize, and possibly ping,
+// before replying; these are answered, other requests are rejected as the
+// plugin is not registered yet.
+func awaitRegistration(srv *server) (map[string]any, error) {
+	for {
+		msg, err := srv.t.RecvMessage()
+		if err != nil {
+			return nil, err
+		}
+		method, isRequest := msg["method"].(string)
+		if !isRequest {
+			if id, _ := msg["id"].(float64); id == registerID {
+				return msg, nil
+			}
+			srv.options.Logger.Warn("ignoring unexpected message before registration", "id", msg["id"])
+			continue
+		}
+		if method == "initialize" || method == "ping" {
+			srv.handleRequest(msg)
+			continue
+		}
+		if _, hasID := msg["id"]; hasID {
+			srv.reject(msg, "plugin not registered yet")
+		}
+	}
+}
 
-	switch method {
+// dispatch routes a request to the matching optional handler interface of p.
+func dispatch(p Plugin, req *Request) (result any, err error) {
+	switch req.Method {
 	case "visitor_panel/render":
-		if h, ok := p.(VisitorPanelRenderer); ok {
-			ctx := &RenderContext{}
-			mapToStruct(params, ctx)
-			result = h.OnVisitorPanelRender(ctx)
+		h, ok := p.(VisitorPanelRenderer)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
 		}
+		ctx := &RenderContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		result = h.OnVisitorPanelRender(ctx)
 	case "visitor_panel/event":
-		if h, ok := p.(VisitorPanelEventHandler); ok {
-			ctx := &EventContext{}
-			mapToStruct(params, ctx)
-			result = h.OnVisitorPanelEvent(ctx)
+		ctx := &EventContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		if action, ok := submitFormModal(req.formModals, ctx); ok {
+			result = action
+			break
+		}
+		h, ok := p.(VisitorPanelEventHandler)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
 		}
+		result = h.OnVisitorPanelEvent(ctx)
 	case "chat_toolbar/render":
-		if h, ok := p.(ChatToolbarRenderer); ok {
-			ctx := &RenderContext{}
-			mapToStruct(params, ctx)
-			result = h.OnChatToolbarRender(ctx)
+		h, ok := p.(ChatToolbarRenderer)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
 		}
+		ctx := &RenderContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		result = h.OnChatToolbarRender(ctx)
 	case "chat_toolbar/event":
-		if h, ok := p.(ChatToolbarEventHandler); ok {
-			ctx := &EventContext{}
-			mapToStruct(params, ctx)
-			result = h.OnChatToolbarEvent(ctx)
+		ctx := &EventContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		if action, ok := submitFormModal(req.formModals, ctx); ok {
+			result = action
+			break
+		}
+		h, ok := p.(ChatToolbarEventHandler)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
+		}
+		result = h.OnChatToolbarEvent(ctx)
+	case "dashboard_widget/render":
+		h, ok := p.(DashboardWidgetRenderer)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
+		}
+		ctx := &RenderContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		result = h.OnDashboardRender(ctx)
+	case "settings/render":
+		h, ok := p.(SettingsRenderer)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
+		}
+		ctx := &RenderContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		result = h.OnSettingsRender(ctx)
+	case "settings/save":
+		h, ok := p.(SettingsHandler)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
 		}
+		ctx := &EventContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		result = h.OnSettingsSave(ctx)
+	case "webhook/invoke":
+		h, ok := p.(WebhookHandler)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
+		}
+		ctx := &WebhookContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		resp := h.OnWebhook(ctx)
+		if resp == nil {
+			resp = &WebhookResponse{}
+		}
+		if resp.Status == 0 {
+			resp.Status = 200
+		}
+		result = resp
+	case "slash_command/invoke":
+		h, ok := p.(SlashCommandHandler)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
+		}
+		ctx := &EventContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		result = h.OnSlashCommand(ctx)
+	case "task/run":
+		h, ok := p.(ScheduledTaskHandler)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
+		}
+		ctx := &TaskContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		err = h.OnScheduledTask(ctx)
+	case "reply_templates/list":
+		h, ok := p.(ReplyTemplateProvider)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
+		}
+		ctx := &RenderContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		replies := h.OnReplyTemplates(ctx)
+		if replies == nil {
+			replies = []Reply{}
+		}
+		result = map[string]any{"replies": replies}
 	case "sidebar_iframe/config":
-		if h, ok := p.(SidebarIframeConfigurator); ok {
-			result = h.OnSidebarIframeConfig(params)
+		h, ok := p.(SidebarIframeConfigurator)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
 		}
+		result = h.OnSidebarIframeConfig(req.Params)
 	case "channel_integration/manifest":
-		if h, ok := p.(ChannelIntegrationManifestProvider); ok {
-			result = h.OnChannelIntegrationManifest(params)
+		h, ok := p.(ChannelIntegrationManifestProvider)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
+		}
+		result = h.OnChannelIntegrationManifest(req.Params)
+	case "channel_integration/message":
+		h, ok := p.(ChannelMessageHandler)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
+		}
+		ctx := &ChannelContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
 		}
+		err = h.OnChannelMessageReceive(ctx)
 	case "tool/execute":
-		if h, ok := p.(ToolHandler); ok {
-			ctx := &ToolContext{}
-			mapToStruct(params, ctx)
-			toolName, _ := params["tool_name"].(string)
-			args, _ := params["arguments"].(map[string]any)
-			result, err = h.OnToolExecute(ctx, toolName, args)
+		h, ok := p.(ToolHandler)
+		if !ok {
+			return nil, errNotImplemented(req.Method)
+		}
+		ctx := &ToolContext{}
+		if err := req.decode(ctx); err != nil {
+			return nil, err
+		}
+		toolName, _ := req.Params["tool_name"].(string)
+		args, _ := req.Params["arguments"].(map[string]any)
+		if args == nil {
+			args = map[string]any{}
+		}
+		// Declared at registration or by the latest UpdateCapabilities
+		def := req.enablement.tool(toolName)
+		if def != nil && def.Streaming && req.Host.ProtocolVersion() >= 3 {
+			ctx.Stream = &ToolStream{host: req.Host, requestID: ctx.RequestID(), toolName: toolName}
+		}
+		// Dry runs have no side effects, so they do not count against the limit
+		if def != nil && def.RateLimitN > 0 && req.limiter != nil && !ctx.DryRun {
+			key := toolName
+			if def.PerVisitor {
+				key += "\n" + ctx.VisitorID
+			}
+			if ok, wait := req.limiter.allow(key, def.RateLimitN, def.RateLimitPer, time.Now()); !ok {
+				result = &ToolResult{
+					Success: false,
+					Content: fmt.Sprintf("tool %s is rate limited, retry after %s", toolName, wait.Round(time.Millisecond)),
+					Data:    map[string]any{"retry_after_ms": wait.Milliseconds()},
+					Error:   "rate limited",
+				}
+				break
+			}
+		}
+		if def != nil {
+			def.applyDefaults(args)
+			if verr := def.validate(args); verr != nil {
+				result = &ToolResult{Success: false, Content: verr.Error(), Error: verr.Error()}
+				break
+			}
 		}
+		timeout := req.toolTimeout
+		if def != nil && def.Timeout > 0 {
+			timeout = def.Timeout
+		}
+		if timeout <= 0 {
+			result, err = executeTool(h, def, ctx, toolName, args)
+			break
+		}
+		result, err = executeToolWithTimeout(h, def, ctx, toolName, args, timeout)
 	default:
-		err = fmt.Errorf("method not found: %s", method)
+		err = &RPCError{Code: CodeMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
 	}
 
-	if err != nil {
-		t.SendMessage(map[string]any{
-			"jsonrpc": "2.0",
-			"id":      id,
-			"error":   map[string]any{"code": -32601, "message": err.Error()},
-		})
-		return
-	}
+	return result, err
+}
 
-	// If no handler was implemented but method exists
-	if result == nil {
-		t.SendMessage(map[string]any{
-			"jsonrpc": "2.0",
-			"id":      id,
-			"result":  map[string]any{"success": true},
-		})
-		return
+// executeToolWithTimeout runs executeTool under a context deadline. If the
+// deadline passes first, a timeout ToolResult is returned while the handler
+// may still be running.
+func executeToolWithTimeout(h ToolHandler, def *MCPToolDefinition, ctx *ToolContext, name string, args map[string]any, timeout time.Duration) (*ToolResult, error) {
+	tctx, cancel := context.WithTimeout(ctx.RequestContext(), timeout)
+	defer cancel()
+	ctx.ctx = tctx
+
+	type outcome struct {
+		result *ToolResult
+		err    error
 	}
+	done := make(chan outcome, 1)
+	go func() {
+		// Panics cannot reach the recover of processRequest from here
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: &RPCError{Code: CodeInternalError, Message: fmt.Sprintf("internal error: %v", r)}}
+			}
+		}()
+		result, err := executeTool(h, def, ctx, name, args)
+		done <- outcome{result, err}
+	}()
 
-	// Unwrap potential builders
-	if b, ok := result.(interface{ ToMap() map[string]any }); ok {
-		result = b.ToMap()
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-tctx.Done():
+		ctx.Logger().Warn("tool timed out", "tool", name, "timeout", timeout)
+		return &ToolResult{Success: false, Content: fmt.Sprintf("tool %s timed out after %s", name, timeout), Error: "timeout"}, nil
 	}
+}
 
-	t.SendMessage(map[string]any{
-		"jsonrpc": "2.0",
-		"id":      id,
-		"result":  result,
-	})
+// executeTool runs a tool, retrying RetryableError failures as declared with
+// ToolBuilder.WithRetry.
+func executeTool(h ToolHandler, def *MCPToolDefinition, ctx *ToolContext, name string, args map[string]any) (*ToolResult, error) {
+	result, err := h.OnToolExecute(ctx, name, args)
+	if def == nil {
+		return result, err
+	}
+	backoff := def.RetryBackoff
+	for attempt := 1; attempt < def.MaxAttempts; attempt++ {
+		var rerr *RetryableError
+		if !errors.As(err, &rerr) {
+			break
+		}
+		reqCtx := ctx.RequestContext()
+		if deadline, ok := reqCtx.Deadline(); ok && time.Until(deadline) < backoff {
+			break
+		}
+		ctx.Logger().Debug("retrying tool", "tool", name, "attempt", attempt+1, "error", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-reqCtx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+		backoff *= 2
+		result, err = h.OnToolExecute(ctx, name, args)
+	}
+	return result, err
 }
 
 // Helper to convert map[string]any to struct via JSON (simple approach)
-func mapToStruct(m map[string]any, s any) {
-	data, _ := json.Marshal(m)
-	json.Unmarshal(data, s)
+func mapToStruct(m map[string]any, s any) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, s)
 }
 
 // BasePlugin provides default implementations for Plugin interface.
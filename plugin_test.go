@@ -0,0 +1,245 @@
+package tgo_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tgoai/tgo-plugin-go"
+)
+
+func testPlugin() *tgo.BasePlugin {
+	return &tgo.BasePlugin{PID: "test", PName: "Test", PVersion: "1.0.0", Caps: []tgo.Capability{tgo.VisitorPanel("Test")}}
+}
+
+// startPlugin runs p with RunContext over a pipe and returns the host end of
+// the connection without answering registration.
+func startPlugin(t *testing.T, p tgo.Plugin, opts ...tgo.Option) (*tgo.Transport, <-chan error) {
+	t.Helper()
+	hostConn, pluginConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	opts = append(opts, tgo.WithTransport(tgo.NewConnTransport(pluginConn)))
+	go func() { done <- tgo.RunContext(ctx, p, opts...) }()
+	t.Cleanup(func() {
+		cancel()
+		hostConn.Close()
+	})
+	return tgo.NewConnTransport(hostConn), done
+}
+
+// connectPlugin is like startPlugin but also accepts the registration.
+func connectPlugin(t *testing.T, p tgo.Plugin, opts ...tgo.Option) (*tgo.Transport, <-chan error) {
+	t.Helper()
+	host, done := startPlugin(t, p, opts...)
+	msg, err := host.RecvMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg["method"] != "register" {
+		t.Fatalf("expected register, got %v", msg)
+	}
+	if err := host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": msg["id"], "result": map[string]any{"success": true, "protocol_version": tgo.ProtocolVersion}}); err != nil {
+		t.Fatal(err)
+	}
+	return host, done
+}
+
+func TestRegisterAnswersInitializeFirst(t *testing.T) {
+	host, done := startPlugin(t, testPlugin())
+
+	// net.Pipe is unbuffered and the plugin is writing register meanwhile.
+	sent := make(chan error, 1)
+	go func() {
+		sent <- host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": "init-1", "method": "initialize", "params": map[string]any{}})
+	}()
+
+	var register, initialized map[string]any
+	for register == nil || initialized == nil {
+		msg, err := host.RecvMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case msg["method"] == "register":
+			register = msg
+		case msg["id"] == "init-1":
+			initialized = msg
+		default:
+			t.Fatalf("unexpected message %v", msg)
+		}
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	result, _ := initialized["result"].(map[string]any)
+	if result["protocol_version"] != float64(tgo.ProtocolVersion) {
+		t.Fatalf("unexpected initialize reply %v", initialized)
+	}
+
+	if err := host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": register["id"], "result": map[string]any{"success": true, "protocol_version": tgo.ProtocolVersion}}); err != nil {
+		t.Fatal(err)
+	}
+	go host.Serve(func(map[string]any) {}, nil)
+	if _, err := host.Call("ping", nil); err != nil {
+		t.Fatalf("plugin not serving after registration: %v", err)
+	}
+	if _, err := host.Call("shutdown", nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("RunContext: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunContext did not return after shutdown")
+	}
+}
+
+func TestRegisterRejectsRequestsBeforeReply(t *testing.T) {
+	host, done := startPlugin(t, testPlugin())
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": "early", "method": "visitor_panel/render", "params": map[string]any{}})
+	}()
+
+	var register, rejected map[string]any
+	for register == nil || rejected == nil {
+		msg, err := host.RecvMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg["method"] == "register" {
+			register = msg
+		} else {
+			rejected = msg
+		}
+	}
+	<-sent
+	if e, _ := rejected["error"].(map[string]any); e["code"] != float64(tgo.CodeServerBusy) {
+		t.Fatalf("unexpected reply %v", rejected)
+	}
+
+	go host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": register["id"], "result": map[string]any{"success": false}})
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("RunContext succeeded after a rejected registration")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunContext did not return")
+	}
+}
+
+// stoppingPlugin records whether a render was still running at OnStop.
+type stoppingPlugin struct {
+	tgo.BasePlugin
+	started   chan struct{}
+	rendering atomic.Bool
+	stopped   chan bool
+}
+
+func (p *stoppingPlugin) OnVisitorPanelRender(ctx *tgo.RenderContext) tgo.Template {
+	p.rendering.Store(true)
+	close(p.started)
+	time.Sleep(100 * time.Millisecond)
+	p.rendering.Store(false)
+	return tgo.NewText("done")
+}
+
+func (p *stoppingPlugin) OnStop() { p.stopped <- p.rendering.Load() }
+
+func TestRunContextDrainsWhenConnectionLost(t *testing.T) {
+	p := &stoppingPlugin{BasePlugin: *testPlugin(), started: make(chan struct{}), stopped: make(chan bool, 1)}
+	host, done := connectPlugin(t, p)
+	go host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": 2, "method": "visitor_panel/render", "params": map[string]any{}})
+	<-p.started
+	host.Close()
+
+	if err := <-done; err == nil {
+		t.Fatal("RunContext returned nil after the connection was lost")
+	}
+	if <-p.stopped {
+		t.Fatal("OnStop ran while a handler was still running")
+	}
+}
+
+type largePlugin struct{ tgo.BasePlugin }
+
+func (p *largePlugin) OnVisitorPanelRender(ctx *tgo.RenderContext) tgo.Template {
+	return tgo.NewText(strings.Repeat("large ", 1000))
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	for _, accept := range []bool{true, false} {
+		hostConn, pluginConn := net.Pipe()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		defer hostConn.Close()
+		go tgo.RunContext(ctx, &largePlugin{BasePlugin: *testPlugin()},
+			tgo.WithTransport(tgo.NewConnTransport(pluginConn)), tgo.WithCompression(1024))
+		host := tgo.NewConnTransport(hostConn) // Only used for sending
+
+		body, _ := readFrame(t, hostConn)
+		var register map[string]any
+		json.Unmarshal(body, &register)
+		if offered, _ := register["params"].(map[string]any)["compression"].([]any); len(offered) != 1 || offered[0] != "gzip" {
+			t.Fatalf("compression not offered: %v", register["params"])
+		}
+		result := map[string]any{"success": true, "protocol_version": tgo.ProtocolVersion}
+		if accept {
+			result["compression"] = "gzip"
+		}
+		// Writes to a net.Pipe return once the plugin has read the reply, so
+		// the requests below cannot overtake it.
+		if err := host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": register["id"], "result": result}); err != nil {
+			t.Fatal(err)
+		}
+
+		go host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": 2, "method": "ping"})
+		if _, compressed := readFrame(t, hostConn); compressed {
+			t.Errorf("accept %v: small reply compressed", accept)
+		}
+		go host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": 3, "method": "visitor_panel/render", "params": map[string]any{}})
+		body, compressed := readFrame(t, hostConn)
+		if compressed != accept {
+			t.Errorf("accept %v: large reply compressed %v", accept, compressed)
+		}
+		var reply map[string]any
+		if err := json.Unmarshal(body, &reply); err != nil || reply["result"] == nil {
+			t.Errorf("accept %v: unexpected reply %s", accept, body)
+		}
+	}
+}
+
+func TestRunContextCancelDuringRegistration(t *testing.T) {
+	// The host never reads the register request, or reads it and never replies.
+	for _, readRegister := range []bool{false, true} {
+		hostConn, pluginConn := net.Pipe()
+		defer hostConn.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- tgo.RunContext(ctx, testPlugin(), tgo.WithTransport(tgo.NewConnTransport(pluginConn))) }()
+		if readRegister {
+			if _, err := tgo.NewConnTransport(hostConn).RecvMessage(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("read register %v: RunContext returned %v, want nil", readRegister, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("read register %v: RunContext did not return after cancel", readRegister)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package tgo
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter enforces the rate limits declared with ToolBuilder.RateLimit
+// using one token bucket per tool, or per tool and visitor.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	size   float64
+	rate   float64 // Tokens per nanosecond
+}
+
+// refill adds the tokens accrued since the last update.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(b.size, b.tokens+float64(now.Sub(b.last))*b.rate)
+	b.last = now
+}
+
+// maxBuckets bounds the number of tracked buckets; beyond it full buckets,
+// which behave like new ones, are dropped.
+const maxBuckets = 10000
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: map[string]*bucket{}}
+}
+
+// allow takes a token for key from a bucket holding n tokens refilled over
+// per. If none is left it returns false and the wait until the next token.
+func (l *rateLimiter) allow(key string, n int, per time.Duration, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: float64(n), last: now, size: float64(n), rate: float64(n) / float64(per)}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / b.rate)
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *rateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.refill(now); b.tokens >= b.size {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package tgo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tgoai/tgo-plugin-go"
+)
+
+func TestRateLimitValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		tool  *tgo.ToolBuilder
+		valid bool
+	}{
+		{"none", tgo.Tool("t", "T"), true},
+		{"valid", tgo.Tool("t", "T").RateLimit(5, time.Minute), true},
+		{"per visitor", tgo.Tool("t", "T").RateLimitPerVisitor(1, time.Second), true},
+		{"zero per", tgo.Tool("t", "T").RateLimit(5, 0), false},
+		{"negative per", tgo.Tool("t", "T").RateLimit(5, -time.Second), false},
+		{"zero n", tgo.Tool("t", "T").RateLimit(0, time.Minute), false},
+		{"negative n", tgo.Tool("t", "T").RateLimitPerVisitor(-1, time.Minute), false},
+	}
+	for _, tt := range tests {
+		p := &tgo.BasePlugin{PID: "p", PName: "P", PVersion: "1.0.0", Caps: []tgo.Capability{tgo.MCPTools(tt.tool)}}
+		if _, err := tgo.Manifest(p); (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package tgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// server holds the state of a running plugin between Run and its request handlers.
+type server struct {
+	p       Plugin
+	t       *Transport
+	options *Options
+	enabled *enablement
+	limiter *rateLimiter
+	dedupe  *idempotencyCache     // nil unless WithIdempotency is set
+	modals  map[string]*FormModal // By action id, see FormModalProvider
+	sem     chan struct{}         // Limits concurrent handlers, nil if unlimited
+
+	mu       sync.Mutex
+	closing  bool
+	inflight sync.WaitGroup
+	active   atomic.Int64 // Requests in flight, for health
+	started  time.Time
+
+	shutdown     chan struct{} // Closed when the host requests shutdown
+	shutdownOnce sync.Once
+}
+
+func newServer(p Plugin, t *Transport, options *Options) *server {
+	s := &server{p: p, t: t, options: options, enabled: newEnablement(p.Capabilities()), limiter: newRateLimiter(), shutdown: make(chan struct{}), started: time.Now()}
+	if options.MaxConcurrency > 0 {
+		s.sem = make(chan struct{}, options.MaxConcurrency)
+	}
+	if options.IdempotencyTTL > 0 {
+		s.dedupe = newIdempotencyCache(options.IdempotencyTTL)
+	}
+	s.modals = formModals(p)
+	return s
+}
+
+// stop asks Run to drain and return.
+func (s *server) stop() {
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+}
+
+// startRequest calls run in a new goroutine. With MaxConcurrency set, at
+// most that many requests run at once; ping, health and shutdown bypass the limit.
+// Requests arriving while the server drains are rejected.
+func (s *server) startRequest(msg map[string]any, run func()) {
+	method, _ := msg["method"].(string)
+	if !s.begin(msg) {
+		return
+	}
+	s.active.Add(1)
+	task := func() {
+		defer s.active.Add(-1)
+		run()
+	}
+
+	if s.options.RejectWhenBusy {
+		release, ok := s.acquire(method, false)
+		if !ok {
+			s.active.Add(-1)
+			s.inflight.Done()
+			s.reject(msg, "server busy")
+			return
+		}
+		go func() {
+			defer s.inflight.Done()
+			defer release()
+			task()
+		}()
+		return
+	}
+
+	// Queue in a goroutine rather than blocking the caller, since Serve must
+	// keep delivering host responses to handlers that are waiting on them.
+	go func() {
+		defer s.inflight.Done()
+		release, _ := s.acquire(method, true)
+		defer release()
+		task()
+	}()
+}
+
+// startBatch handles batch in a new goroutine. Its elements are subject to
+// MaxConcurrency one by one, see handleBatch.
+func (s *server) startBatch(batch []map[string]any) {
+	if !s.begin(nil) {
+		return
+	}
+	go func() {
+		defer s.inflight.Done()
+		s.handleBatch(batch)
+	}()
+}
+
+// begin counts a request as in flight, or rejects msg and reports false if
+// the server is draining. msg is nil for a batch.
+func (s *server) begin(msg map[string]any) bool {
+	s.mu.Lock()
+	closing := s.closing
+	if !closing {
+		s.inflight.Add(1)
+	}
+	s.mu.Unlock()
+	if closing {
+		s.reject(msg, "server shutting down")
+	}
+	return !closing
+}
+
+// acquire takes a concurrency slot for a request to method, waiting for one
+// if wait is set. It reports false if no slot is free without waiting.
+// release must be called once the request is done.
+func (s *server) acquire(method string, wait bool) (release func(), ok bool) {
+	if s.sem == nil || method == "ping" || method == "health" || method == "shutdown" {
+		return func() {}, true
+	}
+	if wait {
+		s.sem <- struct{}{}
+	} else {
+		select {
+		case s.sem <- struct{}{}:
+		default:
+			return nil, false
+		}
+	}
+	return func() { <-s.sem }, true
+}
+
+// reject replies to msg with a server error without running it.
+func (s *server) reject(msg map[string]any, reason string) {
+	s.options.Logger.Warn("rejecting request", "method", msg["method"], "id", msg["id"], "reason", reason)
+	s.t.SendMessage(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      msg["id"],
+		"error":   map[string]any{"code": CodeServerBusy, "message": reason},
+	})
+}
+
+// drain stops accepting requests and waits for in-flight ones to finish.
+func (s *server) drain() {
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+	s.inflight.Wait()
+}
+
+func (s *server) handleRequest(msg map[string]any) {
+	if resp := s.processRequest(msg); resp != nil {
+		s.t.SendMessage(resp)
+	}
+}
+
+// handleBatch processes the elements of a JSON-RPC batch concurrently and
+// replies with a single array of their responses. nil elements, which were
+// not objects, and elements without a method are answered with an invalid
+// request error. Notifications get no response, so a batch of only
+// notifications gets no reply.
+func (s *server) handleBatch(batch []map[string]any) {
+	if len(batch) == 0 {
+		s.t.SendMessage(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      nil,
+			"error":   map[string]any{"code": CodeInvalidRequest, "message": "invalid request: empty batch"},
+		})
+		return
+	}
+
+	responses := make([]map[string]any, len(batch))
+	var wg sync.WaitGroup
+	for i, msg := range batch {
+		if msg == nil {
+			responses[i] = map[string]any{
+				"jsonrpc": "2.0",
+				"id":      nil,
+				"error":   map[string]any{"code": CodeInvalidRequest, "message": "invalid request: batch element is not an object"},
+			}
+			continue
+		}
+		method, _ := msg["method"].(string)
+		if method == "" {
+			responses[i] = map[string]any{
+				"jsonrpc": "2.0",
+				"id":      msg["id"],
+				"error":   map[string]any{"code": CodeInvalidRequest, "message": "invalid request: missing method"},
+			}
+			continue
+		}
+		// Each element takes a slot of its own, so a large batch cannot
+		// exceed MaxConcurrency.
+		release, ok := s.acquire(method, !s.options.RejectWhenBusy)
+		if !ok {
+			if _, hasID := msg["id"]; hasID {
+				responses[i] = map[string]any{
+					"jsonrpc": "2.0",
+					"id":      msg["id"],
+					"error":   map[string]any{"code": CodeServerBusy, "message": "server busy"},
+				}
+			}
+			continue
+		}
+		wg.Add(1)
+		s.active.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.active.Add(-1)
+			defer release()
+			responses[i] = s.processRequest(msg)
+		}()
+	}
+	wg.Wait()
+
+	out := make([]map[string]any, 0, len(responses))
+	for _, resp := range responses {
+		if resp != nil {
+			out = append(out, resp)
+		}
+	}
+	if len(out) > 0 {
+		s.t.SendMessage(out)
+	}
+}
+
+// processRequest runs a single request and returns the response to send, or
+// nil if msg is not a request or is a notification, which has no id and gets
+// no reply under JSON-RPC 2.0.
+func (s *server) processRequest(msg map[string]any) (resp map[string]any) {
+	method, _ := msg["method"].(string)
+	id, hasID := msg["id"]
+	params, _ := msg["params"].(map[string]any)
+
+	if method == "" {
+		return nil
+	}
+	// Registered first so it runs last, after metrics have seen the response.
+	defer func() {
+		if !hasID {
+			resp = nil
+		}
+	}()
+
+	traceID, _ := params["trace_id"].(string)
+	logger := s.options.Logger
+	if traceID != "" {
+		logger = WithFields(logger, "id", id, "trace_id", traceID)
+	} else {
+		logger = WithFields(logger, "id", id)
+	}
+
+	if s.options.Metrics != nil {
+		start := time.Now()
+		defer func() { s.options.Metrics.RequestHandled(method, time.Since(start), responseError(resp)) }()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("handler panicked", "method", method, "panic", r)
+			resp = map[string]any{
+				"jsonrpc": "2.0",
+				"id":      id,
+				"error":   map[string]any{"code": CodeInternalError, "message": fmt.Sprintf("internal error: %v", r)},
+			}
+		}
+	}()
+
+	logger.Debug("handling request", "method", method)
+
+	if method == "shutdown" {
+		s.stop()
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"result":  map[string]any{"success": true},
+		}
+	}
+
+	if method == "ping" {
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"result":  map[string]any{"pong": true},
+		}
+	}
+
+	if method == "health" {
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"result":  s.health(),
+		}
+	}
+
+	if method == "initialize" {
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"result":  s.initializeResult(),
+		}
+	}
+
+	if method == "capabilities/set_enabled" {
+		enabled, _ := params["enabled"].(map[string]any)
+		s.enabled.update(enabled)
+		logger.Info("capability enablement changed", "enabled", enabled)
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"result":  map[string]any{"success": true},
+		}
+	}
+
+	if capType := methodCapability(method); !s.enabled.enabled(capType) {
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"error":   map[string]any{"code": CodeDisabled, "message": fmt.Sprintf("capability disabled: %s", capType)},
+		}
+	}
+
+	// Retries of a side-effecting request carry the key of the original.
+	key, _ := params["idempotency_key"].(string)
+	if s.dedupe != nil && key != "" && params["dry_run"] != true {
+		resp, replayed := s.dedupe.do(method+"\x00"+key, func() map[string]any {
+			return s.runHandler(id, method, traceID, params, logger)
+		})
+		if !replayed {
+			return resp
+		}
+		logger.Info("replaying response of duplicate request", "method", method, "idempotency_key", key)
+		replay := make(map[string]any, len(resp))
+		for k, v := range resp {
+			replay[k] = v
+		}
+		replay["id"] = id
+		return replay
+	}
+
+	return s.runHandler(id, method, traceID, params, logger)
+}
+
+// runHandler passes a request through the middleware to its handler and
+// builds the response.
+func (s *server) runHandler(id any, method, traceID string, params map[string]any, logger Logger) map[string]any {
+	var handler HandlerFunc = func(req *Request) (any, error) { return dispatch(s.p, req) }
+	for i := len(s.options.Middleware) - 1; i >= 0; i-- {
+		handler = s.options.Middleware[i](handler)
+	}
+	result, err := handler(&Request{
+		ID:      id,
+		TraceID: traceID,
+		Method:  method,
+		Params:  params,
+		Host:    &HostClient{t: s.t, enabled: s.enabled},
+		Logger:  logger,
+		Context: context.Background(),
+		i18n:    s.options.I18n,
+
+		toolTimeout: s.options.ToolTimeout,
+		enablement:  s.enabled,
+		limiter:     s.limiter,
+		formModals:  s.modals,
+	})
+
+	if err != nil {
+		logger.Warn("request failed", "method", method, "error", err)
+		// Handler failures are not unknown methods, which dispatch reports itself.
+		code := CodeInternalError
+		var rerr *RPCError
+		if errors.As(err, &rerr) {
+			code = rerr.Code
+		}
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"error":   map[string]any{"code": code, "message": err.Error()},
+		}
+	}
+
+	// Handler returned nothing, e.g. a nil Template, a typed nil such as
+	// (*Action)(nil), or a successful task run
+	if isNil(result) {
+		return map[string]any{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"result":  map[string]any{"success": true},
+		}
+	}
+
+	// Unwrap potential builders
+	if b, ok := result.(interface{ ToMap() map[string]any }); ok {
+		result = b.ToMap()
+	}
+
+	return map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	}
+}
+
+// initializeResult builds the reply to an initialize request, sent by hosts
+// using an MCP-style handshake to learn the plugin's protocol version,
+// features and metadata before or alongside registration.
+func (s *server) initializeResult() map[string]any {
+	compression := []string{}
+	if s.options.Compression > 0 {
+		compression = append(compression, "gzip")
+	}
+	result := map[string]any{
+		"protocol_version": ProtocolVersion,
+		"features": map[string]any{
+			"compression": compression,
+			"batch":       true,
+			"streaming":   true,
+		},
+		"plugin": manifest(s.p),
+	}
+	if s.options.InitializeResult != nil {
+		s.options.InitializeResult(result)
+	}
+	return result
+}
+
+// health builds the reply to a health request, sent by orchestrators and
+// readiness probes. The request itself counts as in flight.
+func (s *server) health() map[string]any {
+	stats := s.t.Stats()
+	result := map[string]any{
+		"status":           "ok",
+		"id":               s.p.ID(),
+		"name":             s.p.Name(),
+		"version":          s.p.Version(),
+		"protocol_version": s.t.ProtocolVersion(),
+		"uptime_seconds":   int64(time.Since(s.started).Seconds()),
+		"connected":        s.t.connected(),
+		"inflight":         s.active.Load(),
+		"goroutines":       runtime.NumGoroutine(),
+		"bytes_sent":       stats.BytesSent,
+		"bytes_received":   stats.BytesReceived,
+	}
+	if h, ok := s.p.(HealthReporter); ok {
+		details, err := h.OnHealth()
+		if details != nil {
+			result["details"] = details
+		}
+		if err != nil {
+			result["status"] = "unhealthy"
+			result["error"] = err.Error()
+		}
+	}
+	return result
+}
@@ -0,0 +1,315 @@
+package tgo_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tgoai/tgo-plugin-go"
+	"github.com/tgoai/tgo-plugin-go/tgotest"
+)
+
+// serveBatches runs Serve on the host end and returns the batch replies it receives.
+func serveBatches(host *tgo.Transport) <-chan []map[string]any {
+	batches := make(chan []map[string]any, 1)
+	go host.Serve(func(map[string]any) {}, func(batch []map[string]any) { batches <- batch })
+	return batches
+}
+
+func TestBatchInvalidElement(t *testing.T) {
+	host, done := connectPlugin(t, testPlugin())
+	batches := serveBatches(host)
+
+	if err := host.SendMessage([]any{1, map[string]any{"jsonrpc": "2.0", "id": 7, "method": "ping"}}); err != nil {
+		t.Fatal(err)
+	}
+	var replies []map[string]any
+	select {
+	case replies = <-batches:
+	case err := <-done:
+		t.Fatalf("plugin stopped: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch reply")
+	}
+	if len(replies) != 2 {
+		t.Fatalf("got %d replies, want 2: %v", len(replies), replies)
+	}
+	e, _ := replies[0]["error"].(map[string]any)
+	if e["code"] != float64(tgo.CodeInvalidRequest) || replies[0]["id"] != nil {
+		t.Fatalf("unexpected reply to invalid element %v", replies[0])
+	}
+	if replies[1]["id"] != float64(7) || replies[1]["result"] == nil {
+		t.Fatalf("unexpected reply to ping %v", replies[1])
+	}
+
+	// The connection stays up.
+	if _, err := host.Call("ping", nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchNotifications(t *testing.T) {
+	host, done := connectPlugin(t, testPlugin())
+	batches := make(chan []map[string]any, 2)
+	stray := make(chan map[string]any, 2)
+	go host.Serve(func(msg map[string]any) { stray <- msg }, func(batch []map[string]any) { batches <- batch })
+
+	if err := host.SendMessage([]any{
+		map[string]any{"jsonrpc": "2.0", "method": "ping"},
+		map[string]any{"jsonrpc": "2.0", "id": 8},
+		map[string]any{"jsonrpc": "2.0", "id": 9, "method": "ping"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var replies []map[string]any
+	select {
+	case replies = <-batches:
+	case err := <-done:
+		t.Fatalf("plugin stopped: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch reply")
+	}
+	if len(replies) != 2 {
+		t.Fatalf("got %d replies, want 2: %v", len(replies), replies)
+	}
+	if e, _ := replies[0]["error"].(map[string]any); e["code"] != float64(tgo.CodeInvalidRequest) || replies[0]["id"] != float64(8) {
+		t.Errorf("unexpected reply to element without method %v", replies[0])
+	}
+	if replies[1]["id"] != float64(9) || replies[1]["result"] == nil {
+		t.Errorf("unexpected reply to ping %v", replies[1])
+	}
+
+	// Neither a batch of notifications nor a single one gets a reply.
+	notification := map[string]any{"jsonrpc": "2.0", "method": "ping"}
+	if err := host.SendMessage([]any{notification, notification}); err != nil {
+		t.Fatal(err)
+	}
+	if err := host.SendMessage(notification); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := host.Call("ping", nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-time.After(50 * time.Millisecond): // Time for a stray reply to arrive
+	case batch := <-batches:
+		t.Errorf("notifications got a batch reply %v", batch)
+	case msg := <-stray:
+		t.Errorf("notification got a reply %v", msg)
+	}
+}
+
+// slowPlugin renders slowly and records the peak number of concurrent renders.
+type slowPlugin struct {
+	tgo.BasePlugin
+	running atomic.Int64
+	peak    atomic.Int64
+}
+
+func (p *slowPlugin) OnVisitorPanelRender(ctx *tgo.RenderContext) tgo.Template {
+	n := p.running.Add(1)
+	defer p.running.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return tgo.NewText("ok")
+}
+
+func newSlowPlugin() *slowPlugin {
+	return &slowPlugin{BasePlugin: *testPlugin()}
+}
+
+func renderBatch(n int) []any {
+	batch := make([]any, n)
+	for i := range batch {
+		batch[i] = map[string]any{"jsonrpc": "2.0", "id": i + 1, "method": "visitor_panel/render", "params": map[string]any{}}
+	}
+	return batch
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	p := newSlowPlugin()
+	host, _ := connectPlugin(t, p, tgo.WithMaxConcurrency(3))
+	go host.Serve(func(map[string]any) {}, nil)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := host.Call("visitor_panel/render", map[string]any{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak := p.peak.Load(); peak != 3 {
+		t.Fatalf("peak concurrency %d, want 3", peak)
+	}
+}
+
+func TestMaxConcurrencyRejectWhenBusy(t *testing.T) {
+	p := newSlowPlugin()
+	host, _ := connectPlugin(t, p, tgo.WithMaxConcurrency(1), tgo.WithRejectWhenBusy(true))
+	go host.Serve(func(map[string]any) {}, nil)
+
+	var wg sync.WaitGroup
+	var busy atomic.Int64
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := host.Call("visitor_panel/render", map[string]any{})
+			if rerr, ok := err.(*tgo.RPCError); ok && rerr.Code == tgo.CodeServerBusy {
+				busy.Add(1)
+			} else if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if busy.Load() == 0 {
+		t.Fatal("no request was rejected as busy")
+	}
+	if peak := p.peak.Load(); peak != 1 {
+		t.Fatalf("peak concurrency %d, want 1", peak)
+	}
+}
+
+func TestBatchRespectsMaxConcurrency(t *testing.T) {
+	p := newSlowPlugin()
+	host, _ := connectPlugin(t, p, tgo.WithMaxConcurrency(2))
+	batches := serveBatches(host)
+
+	if err := host.SendMessage(renderBatch(10)); err != nil {
+		t.Fatal(err)
+	}
+	replies := <-batches
+	if len(replies) != 10 {
+		t.Fatalf("got %d replies, want 10", len(replies))
+	}
+	for _, r := range replies {
+		if r["error"] != nil {
+			t.Fatalf("unexpected error %v", r)
+		}
+	}
+	if peak := p.peak.Load(); peak != 2 {
+		t.Fatalf("peak concurrency %d, want 2", peak)
+	}
+}
+
+func TestBatchRejectWhenBusy(t *testing.T) {
+	p := newSlowPlugin()
+	host, _ := connectPlugin(t, p, tgo.WithMaxConcurrency(2), tgo.WithRejectWhenBusy(true))
+	batches := serveBatches(host)
+
+	if err := host.SendMessage(renderBatch(5)); err != nil {
+		t.Fatal(err)
+	}
+	replies := <-batches
+	busy := 0
+	for _, r := range replies {
+		if e, ok := r["error"].(map[string]any); ok && e["code"] == float64(tgo.CodeServerBusy) {
+			busy++
+		}
+	}
+	if len(replies) != 5 || busy != 3 {
+		t.Fatalf("got %d replies with %d busy, want 5 with 3 busy: %v", len(replies), busy, replies)
+	}
+}
+
+// failingPlugin fails its scheduled tasks and channel messages.
+type failingPlugin struct{ tgo.BasePlugin }
+
+func (p *failingPlugin) OnScheduledTask(ctx *tgo.TaskContext) error {
+	return errors.New("database unavailable")
+}
+
+func (p *failingPlugin) OnChannelMessageReceive(ctx *tgo.ChannelContext) error {
+	return errors.New("database unavailable")
+}
+
+func TestHandlerErrorCodes(t *testing.T) {
+	h, err := tgotest.New(&failingPlugin{BasePlugin: *testPlugin()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	tests := []struct {
+		method string
+		code   int
+	}{
+		{"task/run", tgo.CodeInternalError},
+		{"channel_integration/message", tgo.CodeInternalError},
+		{"settings/render", tgo.CodeMethodNotFound}, // Not implemented
+		{"unknown/method", tgo.CodeMethodNotFound},
+	}
+	for _, tt := range tests {
+		_, err := h.Call(tt.method, map[string]any{})
+		var rerr *tgo.RPCError
+		if !errors.As(err, &rerr) || rerr.Code != tt.code {
+			t.Errorf("%s: got %v, want code %d", tt.method, err, tt.code)
+		}
+	}
+}
+
+type healthyPlugin struct{ tgo.BasePlugin }
+
+func (p *healthyPlugin) OnHealth() (map[string]any, error) {
+	return map[string]any{"db": "ok"}, nil
+}
+
+func TestHealth(t *testing.T) {
+	h, err := tgotest.New(&healthyPlugin{BasePlugin: *testPlugin()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	got, err := h.Call("health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["status"] != "ok" || got["connected"] != true || got["id"] != "test" {
+		t.Errorf("unexpected health %v", got)
+	}
+	if details, _ := got["details"].(map[string]any); details["db"] != "ok" {
+		t.Errorf("unexpected details %v", got["details"])
+	}
+	if _, ok := got["reconnects"]; ok {
+		t.Errorf("health reports reconnects of a transport that never reconnects")
+	}
+}
+
+type nilPlugin struct{ tgo.BasePlugin }
+
+func (p *nilPlugin) OnVisitorPanelRender(ctx *tgo.RenderContext) tgo.Template {
+	var text *tgo.Text
+	return text
+}
+
+func (p *nilPlugin) OnVisitorPanelEvent(ctx *tgo.EventContext) *tgo.Action { return nil }
+
+func TestHandlerReturnsTypedNil(t *testing.T) {
+	h, err := tgotest.New(&nilPlugin{BasePlugin: *testPlugin()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	got, err := h.RenderVisitorPanel(&tgo.RenderContext{})
+	if err != nil || got["success"] != true {
+		t.Errorf("render: got %v, %v", got, err)
+	}
+	got, err = h.VisitorPanelEvent(&tgo.EventContext{ActionID: "x"})
+	if err != nil || got["success"] != true {
+		t.Errorf("event: got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,65 @@
+package tgo
+
+import "sync"
+
+// SafeStore is a map guarded by a mutex, for plugin state shared between
+// handlers, which run concurrently. The zero value is an empty store.
+type SafeStore[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  map[K]V
+}
+
+// NewSafeStore creates a store holding a copy of initial, which may be nil.
+func NewSafeStore[K comparable, V any](initial map[K]V) *SafeStore[K, V] {
+	s := &SafeStore[K, V]{m: make(map[K]V, len(initial))}
+	for k, v := range initial {
+		s.m[k] = v
+	}
+	return s
+}
+
+// Get returns the value stored for key and whether it was present.
+func (s *SafeStore[K, V]) Get(key K) (V, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.m[key]
+	return v, ok
+}
+
+// Set stores value for key.
+func (s *SafeStore[K, V]) Set(key K, value V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m == nil {
+		s.m = map[K]V{}
+	}
+	s.m[key] = value
+}
+
+// Delete removes key.
+func (s *SafeStore[K, V]) Delete(key K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+}
+
+// Update atomically replaces the value for key with fn of the current value,
+// the zero value if absent, and returns the new value. Other calls on the
+// store block until fn returns, so fn must not use the store itself.
+func (s *SafeStore[K, V]) Update(key K, fn func(V) V) V {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m == nil {
+		s.m = map[K]V{}
+	}
+	v := fn(s.m[key])
+	s.m[key] = v
+	return v
+}
+
+// Len returns the number of keys stored.
+func (s *SafeStore[K, V]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.m)
+}
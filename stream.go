@@ -0,0 +1,33 @@
+package tgo
+
+import "sync/atomic"
+
+// ToolStream sends partial output of a streaming tool while it runs, see
+// ToolBuilder.Streaming. Each Emit is sent to the host as a "tool/progress"
+// notification
+//
+//	{"request_id": "<id of tool/execute>", "tool_name": "...", "seq": 1, "content": "..."}
+//
+// with seq counting from 1. The host shows the chunks in seq order to the
+// agent and model until the tool/execute response arrives; the final
+// ToolResult then replaces the streamed text.
+type ToolStream struct {
+	host      *HostClient
+	requestID string
+	toolName  string
+	seq       atomic.Int64
+}
+
+// Emit sends a chunk of partial output. It is a no-op on a nil stream, so
+// handlers can emit unconditionally.
+func (s *ToolStream) Emit(partial string) error {
+	if s == nil {
+		return nil
+	}
+	return s.host.Notify("tool/progress", map[string]any{
+		"request_id": s.requestID,
+		"tool_name":  s.toolName,
+		"seq":        s.seq.Add(1),
+		"content":    partial,
+	})
+}
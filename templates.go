@@ -1,10 +1,102 @@
 package tgo
 
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+	"time"
+)
+
 // Template is the interface for all UI templates.
 type Template interface {
 	ToMap() map[string]any
 }
 
+// When returns t if cond is true and nil otherwise. Parents such as Group
+// skip nil templates, so hidden items are left out without branching:
+//
+//	group.Add(tgo.When(priority == "high", tgo.NewButton("Escalate", "escalate")))
+func When(cond bool, t Template) Template {
+	if !cond {
+		return nil
+	}
+	return t
+}
+
+// isNil reports whether t is nil or a nil pointer, such as a *Text that was
+// never assigned.
+func isNil(t any) bool {
+	if t == nil {
+		return true
+	}
+	v := reflect.ValueOf(t)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// cloneItems deep-copies the items of a template. Maps and slices built by
+// the SDK are copied, as are nested templates that have a Clone method; other
+// values, such as user supplied cell data or a nested Text, are shared.
+func cloneItems(items []map[string]any) []map[string]any {
+	if items == nil {
+		return nil
+	}
+	out := make([]map[string]any, len(items))
+	for i, item := range items {
+		out[i] = cloneMap(item)
+	}
+	return out
+}
+
+func cloneMap(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = cloneValue(v)
+	}
+	return out
+}
+
+func cloneValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return cloneMap(v)
+	case []map[string]any:
+		return cloneItems(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = cloneValue(e)
+		}
+		return out
+	case []string:
+		return append([]string(nil), v...)
+	case *Form:
+		if v != nil {
+			return v.Clone()
+		}
+	case *Group:
+		if v != nil {
+			return v.Clone()
+		}
+	case *Table:
+		if v != nil {
+			return v.Clone()
+		}
+	case *KeyValue:
+		if v != nil {
+			return v.Clone()
+		}
+	case *Tabs:
+		if v != nil {
+			return v.Clone()
+		}
+	}
+	return v
+}
+
 // KeyValue template
 type KeyValue struct {
 	Title string           `json:"title,omitempty"`
@@ -15,13 +107,50 @@ func NewKeyValue(title string) *KeyValue {
 	return &KeyValue{Title: title, Items: []map[string]any{}}
 }
 
+// Clone returns a deep copy of kv that can be changed without affecting kv.
+func (kv *KeyValue) Clone() *KeyValue {
+	c := *kv
+	c.Items = cloneItems(kv.Items)
+	return &c
+}
+
 func (kv *KeyValue) Add(label string, value any, opts ...KeyValueOption) *KeyValue {
+	kv.Items = append(kv.Items, keyValueItem(label, value, opts))
+	return kv
+}
+
+// Group appends a titled sub-section and returns it for adding items.
+// It is emitted as an item with type "group" holding its own items.
+func (kv *KeyValue) Group(title string) *KeyValueSection {
+	item := map[string]any{"type": "group", "title": title, "items": []map[string]any{}}
+	kv.Items = append(kv.Items, item)
+	return &KeyValueSection{item: item}
+}
+
+// KeyValueSection is a sub-section of a KeyValue created by KeyValue.Group.
+type KeyValueSection struct {
+	item  map[string]any
+	items []map[string]any
+}
+
+func (s *KeyValueSection) Add(label string, value any, opts ...KeyValueOption) *KeyValueSection {
+	s.items = append(s.items, keyValueItem(label, value, opts))
+	s.item["items"] = s.items
+	return s
+}
+
+// SetCollapsed makes the section start collapsed.
+func (s *KeyValueSection) SetCollapsed(c bool) *KeyValueSection {
+	s.item["collapsed"] = c
+	return s
+}
+
+func keyValueItem(label string, value any, opts []KeyValueOption) map[string]any {
 	item := map[string]any{"label": label, "value": value}
 	for _, opt := range opts {
 		opt(item)
 	}
-	kv.Items = append(kv.Items, item)
-	return kv
+	return item
 }
 
 func (kv *KeyValue) ToMap() map[string]any {
@@ -45,17 +174,43 @@ func KeyValueCopyable(c bool) KeyValueOption {
 	return func(m map[string]any) { m["copyable"] = c }
 }
 
+// KeyValueLink renders the value as a link opening url.
+func KeyValueLink(url string) KeyValueOption {
+	return func(m map[string]any) { m["link"] = url }
+}
+
+// KeyValueAction renders the value as clickable; clicking sends an event with actionID.
+func KeyValueAction(actionID string) KeyValueOption {
+	return func(m map[string]any) { m["action_id"] = actionID }
+}
+
 // Table template
 type Table struct {
-	Title      string           `json:"title,omitempty"`
-	ColumnsArr []map[string]any `json:"columns"`
-	RowsArr    []map[string]any `json:"rows"`
+	Title        string           `json:"title,omitempty"`
+	ColumnsArr   []map[string]any `json:"columns"`
+	RowsArr      []map[string]any `json:"rows"`
+	PageSizeN    int              `json:"page_size,omitempty"`
+	TotalRowsN   int              `json:"total_rows,omitempty"`
+	CurrentPage  int              `json:"page,omitempty"`           // 1-based, server-side mode only
+	PageActionID string           `json:"page_action_id,omitempty"` // Set for server-side pagination
+	RowActionID  string           `json:"row_action_id,omitempty"`
+	RowKeyName   string           `json:"row_key,omitempty"`     // Column holding the row id, defaults to "id"
+	Cursor       string           `json:"next_cursor,omitempty"` // Set by NextCursor
 }
 
 func NewTable(title string) *Table {
 	return &Table{Title: title, ColumnsArr: []map[string]any{}, RowsArr: []map[string]any{}}
 }
 
+// Clone returns a deep copy of t that can be changed without affecting t.
+// Cell values other than templates are shared.
+func (t *Table) Clone() *Table {
+	c := *t
+	c.ColumnsArr = cloneItems(t.ColumnsArr)
+	c.RowsArr = cloneItems(t.RowsArr)
+	return &c
+}
+
 func (t *Table) Columns(cols ...any) *Table {
 	for _, col := range cols {
 		if s, ok := col.(string); ok {
@@ -67,13 +222,129 @@ func (t *Table) Columns(cols ...any) *Table {
 	return t
 }
 
+// Column builds a column definition for Table.Columns.
+func Column(key, label string, opts ...ColumnOption) map[string]any {
+	col := map[string]any{"key": key, "label": label}
+	for _, opt := range opts {
+		opt(col)
+	}
+	return col
+}
+
+type ColumnOption func(map[string]any)
+
+func ColumnSortable(s bool) ColumnOption {
+	return func(m map[string]any) { m["sortable"] = s }
+}
+
+// ColumnWidth sets the column width in pixels.
+func ColumnWidth(px int) ColumnOption {
+	return func(m map[string]any) { m["width"] = px }
+}
+
+// ColumnAlign sets the cell alignment: left, center, right.
+func ColumnAlign(align string) ColumnOption {
+	return func(m map[string]any) { m["align"] = align }
+}
+
+// ColumnType sets the value type used for sorting and formatting: text, number, date.
+func ColumnType(tp string) ColumnOption {
+	return func(m map[string]any) { m["type"] = tp }
+}
+
+// Row appends a copy of row. Cell values may be templates, e.g. a Button,
+// which are rendered inside the cell.
 func (t *Table) Row(row map[string]any) *Table {
-	t.RowsArr = append(t.RowsArr, row)
+	t.RowsArr = append(t.RowsArr, cells(row))
 	return t
 }
 
 func (t *Table) Rows(rows []map[string]any) *Table {
-	t.RowsArr = append(t.RowsArr, rows...)
+	for _, row := range rows {
+		t.RowsArr = append(t.RowsArr, cells(row))
+	}
+	return t
+}
+
+// RowAction makes rows clickable. Clicking a row sends an event with
+// EventType "row_click", ActionID actionID and SelectedID set to the row's
+// value in the "id" column, see RowKey for tables keyed otherwise. A row may
+// override the action with its own "action_id" key. Clicking a Button cell
+// sends an event with the button's ActionID and the same SelectedID.
+func (t *Table) RowAction(actionID string) *Table {
+	t.RowActionID = actionID
+	return t
+}
+
+// RowKey sets the column whose value identifies a row in row_click and
+// button events, e.g. "ID" for a table without an "id" column.
+func (t *Table) RowKey(key string) *Table {
+	t.RowKeyName = key
+	return t
+}
+
+// cells returns a copy of row with template values rendered, leaving the
+// caller's map untouched.
+func cells(row map[string]any) map[string]any {
+	out := make(map[string]any, len(row))
+	for k, v := range row {
+		out[k] = cell(v)
+	}
+	return out
+}
+
+func cell(v any) any {
+	if tmpl, ok := v.(Template); ok {
+		return tmpl.ToMap()
+	}
+	return v
+}
+
+// PageSize enables pagination with n rows per page. Without ServerSide the
+// host pages through all rows on the client.
+func (t *Table) PageSize(n int) *Table {
+	t.PageSizeN = n
+	return t
+}
+
+// TotalRows sets the total number of rows across all pages, used by the host
+// to render page controls when only one page of rows is sent.
+func (t *Table) TotalRows(n int) *Table {
+	t.TotalRowsN = n
+	return t
+}
+
+// ServerSide switches to server-driven pagination: the table holds only the
+// rows of page (1-based) and a page change is sent to the plugin as an event
+// with EventType "page_change", ActionID actionID and
+// Payload {"page": <1-based page>, "page_size": <rows per page>}. Sorting by
+// a sortable column sends the same event for page 1, with "sort_by" set to
+// the column key and "sort_order" to "asc" or "desc". EventContext.Page,
+// PageSize and SortBy read these keys.
+// The handler should answer with UpdateTable carrying that page's rows.
+func (t *Table) ServerSide(actionID string, page int) *Table {
+	t.PageActionID = actionID
+	t.CurrentPage = page
+	return t
+}
+
+// NextCursor marks the table as holding one page of a larger dataset, with
+// c identifying where the next page starts. The host shows a "load more"
+// control; using it sends a render request for the same capability with
+// RenderContext.Cursor set to c. The handler should return a Table holding
+// only the rows of that page, which the host appends to the rows already
+// shown, and call NextCursor again unless it was the last page:
+//
+//	rows, next := orders.List(ctx.Cursor, 50)
+//	t := tgo.NewTable("Orders").Columns("id", "total").Rows(rows)
+//	if next != "" {
+//		t.NextCursor(next)
+//	}
+//	return t
+//
+// Unlike ServerSide, the plugin never needs to count or skip rows.
+func (t *Table) NextCursor(c string) *Table {
+	t.Cursor = c
 	return t
 }
 
@@ -84,6 +355,76 @@ func (t *Table) ToMap() map[string]any {
 	}
 }
 
+// TableFromStructs builds a table with one row per element of rows, which
+// must be structs or pointers to structs. Cells are keyed like the fields
+// encoding/json would encode: by json tag, by name if untagged, skipping "-",
+// and including fields promoted from embedded structs. columns selects and
+// orders the keys shown; rows hold only the selected fields, or all fields if
+// none are given. Cells keep the field values, use Format to convert them for
+// display.
+func TableFromStructs[T any](title string, rows []T, columns ...string) *Table {
+	t := NewTable(title)
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return t
+	}
+	fields := structFields(typ)
+	if len(columns) > 0 {
+		// Only the selected fields are sent, not just shown.
+		byName := make(map[string]codecField, len(fields))
+		for _, f := range fields {
+			byName[f.name] = f
+		}
+		selected := make([]codecField, 0, len(columns))
+		for _, key := range columns {
+			if f, ok := byName[key]; ok {
+				selected = append(selected, f)
+			}
+		}
+		fields = selected
+	} else {
+		for _, f := range fields {
+			columns = append(columns, f.name)
+		}
+	}
+	for _, key := range columns {
+		t.Columns(key)
+	}
+
+	for _, row := range rows {
+		v := reflect.Indirect(reflect.ValueOf(row))
+		if !v.IsValid() {
+			continue
+		}
+		cells := map[string]any{}
+		for _, f := range fields {
+			// Fields of a nil embedded pointer are left out, as in JSON.
+			if fv, ok := fieldByIndex(v, f.index); ok {
+				cells[f.name] = fv.Interface()
+			}
+		}
+		t.Row(cells)
+	}
+	return t
+}
+
+// Format replaces the value of column key in every row with fn(value), e.g.
+// to render a time.Time of TableFromStructs as text. Rows are copied before
+// being changed.
+func (t *Table) Format(key string, fn func(v any) any) *Table {
+	for i, row := range t.RowsArr {
+		if v, ok := row[key]; ok {
+			row = maps.Clone(row)
+			row[key] = cell(fn(v))
+			t.RowsArr[i] = row
+		}
+	}
+	return t
+}
+
 // Text template
 type Text struct {
 	Text     string `json:"text"`
@@ -130,22 +471,138 @@ func (t *Text) ToMap() map[string]any {
 	}
 }
 
+// Time template renders a timestamp localized by the host.
+type Time struct {
+	ISO      string `json:"iso"`                // RFC3339
+	Relative bool   `json:"relative,omitempty"` // e.g. "2 hours ago", kept up to date by the host
+	Format   string `json:"format,omitempty"`   // Layout of absolute times, e.g. "2006-01-02 15:04"
+}
+
+func NewTime(t time.Time) *Time {
+	return &Time{ISO: t.Format(time.RFC3339)}
+}
+
+func (t *Time) SetRelative(r bool) *Time {
+	t.Relative = r
+	return t
+}
+
+func (t *Time) SetFormat(layout string) *Time {
+	t.Format = layout
+	return t
+}
+
+func (t *Time) ToMap() map[string]any {
+	return map[string]any{
+		"template": "time",
+		"data":     t,
+	}
+}
+
+// ErrorTemplate renders a failure, e.g. returned by a renderer when a backend
+// call fails, with an optional retry button.
+type ErrorTemplate struct {
+	Title       string `json:"title"`
+	Detail      string `json:"detail,omitempty"`
+	Level       string `json:"level,omitempty"` // error (default), warning
+	Icon        string `json:"icon,omitempty"`
+	RetryAction string `json:"retry_action_id,omitempty"` // Clicking retry sends an event with this ActionID
+}
+
+func NewError(title, detail string) *ErrorTemplate {
+	return &ErrorTemplate{Title: title, Detail: detail, Level: "error"}
+}
+
+func (e *ErrorTemplate) SetRetryAction(actionID string) *ErrorTemplate {
+	e.RetryAction = actionID
+	return e
+}
+
+func (e *ErrorTemplate) SetLevel(l string) *ErrorTemplate {
+	e.Level = l
+	return e
+}
+
+func (e *ErrorTemplate) SetIcon(icon string) *ErrorTemplate {
+	e.Icon = icon
+	return e
+}
+
+func (e *ErrorTemplate) ToMap() map[string]any {
+	return map[string]any{
+		"template": "error",
+		"data":     e,
+	}
+}
+
+// CodeBlock template shows code, e.g. a curl command, highlighted by language.
+type CodeBlock struct {
+	Code     string `json:"code"`
+	Language string `json:"language,omitempty"` // Highlighting hint, e.g. bash, json, go
+	Copyable bool   `json:"copyable,omitempty"`
+}
+
+func NewCodeBlock(code, language string) *CodeBlock {
+	return &CodeBlock{Code: code, Language: language}
+}
+
+func (c *CodeBlock) SetCopyable(b bool) *CodeBlock {
+	c.Copyable = b
+	return c
+}
+
+func (c *CodeBlock) ToMap() map[string]any {
+	return map[string]any{
+		"template": "code",
+		"data":     c,
+	}
+}
+
 // Group template
 type Group struct {
-	Layout string           `json:"layout,omitempty"` // vertical (default), horizontal
-	Items  []map[string]any `json:"items"`
+	Layout  string           `json:"layout,omitempty"`  // vertical (default), horizontal
+	Gap     int              `json:"gap,omitempty"`     // px between items
+	Align   string           `json:"align,omitempty"`   // cross axis: start, center, end
+	Justify string           `json:"justify,omitempty"` // main axis: start, center, end, between
+	Items   []map[string]any `json:"items"`
 }
 
 func NewGroup() *Group {
 	return &Group{Items: []map[string]any{}}
 }
 
+// Clone returns a deep copy of g that can be changed without affecting g.
+func (g *Group) Clone() *Group {
+	c := *g
+	c.Items = cloneItems(g.Items)
+	return &c
+}
+
 func (g *Group) SetHorizontal() *Group {
 	g.Layout = "horizontal"
 	return g
 }
 
+func (g *Group) SetGap(px int) *Group {
+	g.Gap = px
+	return g
+}
+
+func (g *Group) SetAlign(a string) *Group {
+	g.Align = a
+	return g
+}
+
+func (g *Group) SetJustify(j string) *Group {
+	g.Justify = j
+	return g
+}
+
+// Add appends t; nil templates, e.g. from When, are skipped.
 func (g *Group) Add(t Template) *Group {
+	if t == nil {
+		return g
+	}
 	g.Items = append(g.Items, t.ToMap())
 	return g
 }
@@ -157,6 +614,335 @@ func (g *Group) ToMap() map[string]any {
 	}
 }
 
+// Fragment is a flat sequence of templates that a renderer can return in
+// place of a single one:
+//
+//	return tgo.Fragment{summary, tgo.When(isVIP, vipNotice), orders}
+//
+// Unlike a Group, a fragment has no layout of its own: the host splices its
+// items into the surrounding container, e.g. the panel body, as if they had
+// been returned one after another, so they get the container's spacing.
+// Use a Group when the items need their own direction, gap or alignment.
+// nil items are skipped.
+type Fragment []Template
+
+func (f Fragment) ToMap() map[string]any {
+	items := make([]map[string]any, 0, len(f))
+	for _, t := range f {
+		if t != nil {
+			items = append(items, t.ToMap())
+		}
+	}
+	return map[string]any{
+		"template": "fragment",
+		"data":     map[string]any{"items": items},
+	}
+}
+
+// Grid template arranges its items into columns, e.g. cards on a dashboard.
+type Grid struct {
+	Columns        int              `json:"columns"`
+	Gap            int              `json:"gap,omitempty"`              // px between items
+	MinColumnWidth int              `json:"min_column_width,omitempty"` // px, the host drops columns below it
+	Items          []map[string]any `json:"items"`
+}
+
+func NewGrid(columns int) *Grid {
+	return &Grid{Columns: columns, Items: []map[string]any{}}
+}
+
+func (g *Grid) SetGap(px int) *Grid {
+	g.Gap = px
+	return g
+}
+
+// SetMinColumnWidth makes the grid responsive: on narrow screens the host
+// uses fewer columns so that none is narrower than px.
+func (g *Grid) SetMinColumnWidth(px int) *Grid {
+	g.MinColumnWidth = px
+	return g
+}
+
+// Add appends t; nil templates, e.g. from When, are skipped.
+func (g *Grid) Add(t Template) *Grid {
+	if t == nil {
+		return g
+	}
+	g.Items = append(g.Items, t.ToMap())
+	return g
+}
+
+func (g *Grid) ToMap() map[string]any {
+	return map[string]any{
+		"template": "grid",
+		"data":     g,
+	}
+}
+
+// Steps template
+type Steps struct {
+	Layout string           `json:"layout,omitempty"` // vertical (default), horizontal
+	Items  []map[string]any `json:"steps"`
+}
+
+func NewSteps() *Steps {
+	return &Steps{Items: []map[string]any{}}
+}
+
+// Step appends a stage with status done, active or pending.
+func (s *Steps) Step(title, status string, opts ...StepOption) *Steps {
+	item := map[string]any{"title": title, "status": status}
+	for _, opt := range opts {
+		opt(item)
+	}
+	s.Items = append(s.Items, item)
+	return s
+}
+
+func (s *Steps) SetHorizontal() *Steps {
+	s.Layout = "horizontal"
+	return s
+}
+
+func (s *Steps) ToMap() map[string]any {
+	return map[string]any{
+		"template": "steps",
+		"data":     s,
+	}
+}
+
+type StepOption func(map[string]any)
+
+func StepDescription(d string) StepOption {
+	return func(m map[string]any) { m["description"] = d }
+}
+
+func StepIcon(icon string) StepOption {
+	return func(m map[string]any) { m["icon"] = icon }
+}
+
+// QRCode template
+type QRCode struct {
+	Content string `json:"content"`
+	Size    int    `json:"size,omitempty"` // px
+	Label   string `json:"label,omitempty"`
+}
+
+func NewQRCode(content string) *QRCode {
+	return &QRCode{Content: content}
+}
+
+func (q *QRCode) SetSize(px int) *QRCode {
+	q.Size = px
+	return q
+}
+
+func (q *QRCode) SetLabel(l string) *QRCode {
+	q.Label = l
+	return q
+}
+
+func (q *QRCode) ToMap() map[string]any {
+	return map[string]any{
+		"template": "qrcode",
+		"data":     q,
+	}
+}
+
+// Iframe template embeds a page inline, e.g. a map or a status widget.
+type Iframe struct {
+	URL     string `json:"url"`
+	Height  int    `json:"height,omitempty"` // px
+	Sandbox string `json:"sandbox"`          // iframe sandbox flags, empty for the most restrictive
+}
+
+// NewIframe embeds url sandboxed with "allow-scripts"; use SetSandbox to grant more.
+func NewIframe(url string) *Iframe {
+	return &Iframe{URL: url, Sandbox: "allow-scripts"}
+}
+
+func (f *Iframe) SetHeight(px int) *Iframe {
+	f.Height = px
+	return f
+}
+
+// SetSandbox sets the space separated sandbox flags, e.g. "allow-scripts allow-forms".
+func (f *Iframe) SetSandbox(flags string) *Iframe {
+	f.Sandbox = flags
+	return f
+}
+
+func (f *Iframe) ToMap() map[string]any {
+	return map[string]any{
+		"template": "iframe",
+		"data":     f,
+	}
+}
+
+// Map template shows a location on the host's map provider. The SDK only
+// carries coordinates: plugins need no map API key.
+type Map struct {
+	Lat     float64     `json:"lat"`
+	Lng     float64     `json:"lng"`
+	Zoom    int         `json:"zoom,omitempty"` // 1 (world) to 20 (building), host default if 0
+	Label   string      `json:"label,omitempty"`
+	Markers []MapMarker `json:"markers,omitempty"`
+}
+
+// MapMarker is a pin on a Map.
+type MapMarker struct {
+	Lat   float64 `json:"lat"`
+	Lng   float64 `json:"lng"`
+	Label string  `json:"label,omitempty"`
+}
+
+// NewMap creates a map centered on lat, lng in degrees.
+func NewMap(lat, lng float64) *Map {
+	return &Map{Lat: lat, Lng: lng}
+}
+
+func (m *Map) SetZoom(z int) *Map {
+	m.Zoom = z
+	return m
+}
+
+func (m *Map) SetLabel(l string) *Map {
+	m.Label = l
+	return m
+}
+
+// AddMarker places a pin at lat, lng, e.g. the visitor's location.
+func (m *Map) AddMarker(lat, lng float64, label string) *Map {
+	m.Markers = append(m.Markers, MapMarker{Lat: lat, Lng: lng, Label: label})
+	return m
+}
+
+// ToMap renders an error text instead of the map if a coordinate is out of
+// range, i.e. latitude outside [-90, 90] or longitude outside [-180, 180].
+func (m *Map) ToMap() map[string]any {
+	if err := validCoordinates(m.Lat, m.Lng); err != nil {
+		return NewText("invalid map center: " + err.Error()).SetType("error").ToMap()
+	}
+	for i, mk := range m.Markers {
+		if err := validCoordinates(mk.Lat, mk.Lng); err != nil {
+			return NewText(fmt.Sprintf("invalid map marker %d: %v", i, err)).SetType("error").ToMap()
+		}
+	}
+	return map[string]any{
+		"template": "map",
+		"data":     m,
+	}
+}
+
+func validCoordinates(lat, lng float64) error {
+	if !(lat >= -90 && lat <= 90) {
+		return fmt.Errorf("latitude %v out of range", lat)
+	}
+	if !(lng >= -180 && lng <= 180) {
+		return fmt.Errorf("longitude %v out of range", lng)
+	}
+	return nil
+}
+
+// Avatar template
+type Avatar struct {
+	Name     string `json:"name"`
+	Image    string `json:"image,omitempty"`
+	Initials string `json:"initials,omitempty"` // Derived from Name when Image is empty
+	Subtitle string `json:"subtitle,omitempty"`
+	Status   string `json:"status,omitempty"` // online, offline
+}
+
+func NewAvatar(name string) *Avatar {
+	return &Avatar{Name: name}
+}
+
+func (a *Avatar) SetImage(url string) *Avatar {
+	a.Image = url
+	return a
+}
+
+func (a *Avatar) SetSubtitle(s string) *Avatar {
+	a.Subtitle = s
+	return a
+}
+
+func (a *Avatar) SetStatus(s string) *Avatar {
+	a.Status = s
+	return a
+}
+
+func (a *Avatar) ToMap() map[string]any {
+	data := *a
+	if data.Image == "" && data.Initials == "" {
+		data.Initials = initials(data.Name)
+	}
+	return map[string]any{
+		"template": "avatar",
+		"data":     &data,
+	}
+}
+
+// initials returns the first letters of the first and last word of name,
+// or the first letter of a single word name such as "张三".
+func initials(name string) string {
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return ""
+	}
+	first := []rune(words[0])[:1]
+	if len(words) == 1 {
+		return strings.ToUpper(string(first))
+	}
+	last := []rune(words[len(words)-1])[:1]
+	return strings.ToUpper(string(first) + string(last))
+}
+
+// Container template
+type Container struct {
+	Content    map[string]any `json:"content,omitempty"` // nil for an empty container
+	Padding    int            `json:"padding,omitempty"` // px
+	Border     bool           `json:"border,omitempty"`
+	Background string         `json:"background,omitempty"`
+	MaxHeight  int            `json:"max_height,omitempty"` // px, content scrolls beyond it
+}
+
+// NewContainer wraps content, which may be nil, e.g. from When, to leave
+// the container empty.
+func NewContainer(content Template) *Container {
+	if isNil(content) {
+		return &Container{}
+	}
+	return &Container{Content: content.ToMap()}
+}
+
+func (c *Container) SetPadding(px int) *Container {
+	c.Padding = px
+	return c
+}
+
+func (c *Container) SetBorder(b bool) *Container {
+	c.Border = b
+	return c
+}
+
+func (c *Container) SetBackground(color string) *Container {
+	c.Background = color
+	return c
+}
+
+func (c *Container) SetMaxHeight(px int) *Container {
+	c.MaxHeight = px
+	return c
+}
+
+func (c *Container) ToMap() map[string]any {
+	return map[string]any{
+		"template": "container",
+		"data":     c,
+	}
+}
+
 // Tabs template
 type Tabs struct {
 	DefaultTab string           `json:"default_tab,omitempty"`
@@ -167,16 +953,63 @@ func NewTabs(defaultTab string) *Tabs {
 	return &Tabs{DefaultTab: defaultTab, Items: []map[string]any{}}
 }
 
-func (t *Tabs) AddTab(key, label string, content Template, icon string) *Tabs {
-	t.Items = append(t.Items, map[string]any{
+// Clone returns a deep copy of t that can be changed without affecting t.
+func (t *Tabs) Clone() *Tabs {
+	c := *t
+	c.Items = cloneItems(t.Items)
+	return &c
+}
+
+func (t *Tabs) AddTab(key, label string, content Template, icon string, opts ...TabOption) *Tabs {
+	item := map[string]any{
 		"key":     key,
 		"label":   label,
 		"icon":    icon,
 		"content": content.ToMap(),
-	})
+	}
+	for _, opt := range opts {
+		opt(item)
+	}
+	t.Items = append(t.Items, item)
+	return t
+}
+
+// AddLazyTab adds a tab whose content is fetched when first opened. The host
+// then sends an event with EventType "tab_open", ActionID fetchActionID and
+// SelectedID key; the handler answers with UpdateRegion(key, content).
+func (t *Tabs) AddLazyTab(key, label, fetchActionID, icon string, opts ...TabOption) *Tabs {
+	item := map[string]any{
+		"key":             key,
+		"label":           label,
+		"icon":            icon,
+		"fetch_action_id": fetchActionID,
+	}
+	for _, opt := range opts {
+		opt(item)
+	}
+	t.Items = append(t.Items, item)
 	return t
 }
 
+type TabOption func(map[string]any)
+
+// TabBadge shows count in a chip next to the tab label. A count of 0 or
+// less shows no badge.
+func TabBadge(count int) TabOption {
+	return func(m map[string]any) {
+		if count > 0 {
+			m["badge"] = count
+		} else {
+			delete(m, "badge")
+		}
+	}
+}
+
+// TabDot marks the tab with a dot instead of a count, sent as badge "dot".
+func TabDot() TabOption {
+	return func(m map[string]any) { m["badge"] = "dot" }
+}
+
 func (t *Tabs) ToMap() map[string]any {
 	return map[string]any{
 		"template": "tabs",
@@ -190,12 +1023,23 @@ type Form struct {
 	Fields     []map[string]any `json:"fields"`
 	SubmitText string           `json:"submit_text,omitempty"`
 	CancelText string           `json:"cancel_text,omitempty"`
+
+	SubmitActionID string `json:"submit_action_id,omitempty"`
+	CancelActionID string `json:"cancel_action_id,omitempty"`
 }
 
 func NewForm(title string) *Form {
 	return &Form{Title: title, Fields: []map[string]any{}}
 }
 
+// Clone returns a deep copy of f, e.g. to derive variants of a base form
+// without the changes leaking into it or each other.
+func (f *Form) Clone() *Form {
+	c := *f
+	c.Fields = cloneItems(f.Fields)
+	return &c
+}
+
 func (f *Form) Add(field *FormField) *Form {
 	f.Fields = append(f.Fields, field.ToMap())
 	return f
@@ -219,6 +1063,21 @@ func (f *Form) AddField(name, label, tp string, required bool, opts ...FormField
 func (f *Form) SetSubmitText(t string) *Form { f.SubmitText = t; return f }
 func (f *Form) SetCancelText(t string) *Form { f.CancelText = t; return f }
 
+// SubmitAction sets the action id of the submit button. Submitting sends an
+// event with EventType "form_submit", ActionID actionID and the field values
+// in FormData. Without it the host uses the action id "submit".
+func (f *Form) SubmitAction(actionID string) *Form {
+	f.SubmitActionID = actionID
+	return f
+}
+
+// CancelAction makes the cancel button send an event with EventType
+// "form_cancel" and ActionID actionID. Without it cancelling only closes the form.
+func (f *Form) CancelAction(actionID string) *Form {
+	f.CancelActionID = actionID
+	return f
+}
+
 func (f *Form) ToMap() map[string]any {
 	return map[string]any{
 		"template": "form",
@@ -240,23 +1099,73 @@ func FormDefault(d any) FormFieldOption {
 	return func(m map[string]any) { m["default"] = d }
 }
 
+// FormMin sets the smallest value accepted by a number field.
+func FormMin(v float64) FormFieldOption {
+	return func(m map[string]any) { m["min"] = v }
+}
+
+// FormMax sets the largest value accepted by a number field.
+func FormMax(v float64) FormFieldOption {
+	return func(m map[string]any) { m["max"] = v }
+}
+
+// FormStep sets the increment of a number field, e.g. 0.01 for amounts.
+func FormStep(v float64) FormFieldOption {
+	return func(m map[string]any) { m["step"] = v }
+}
+
+// FormMinDate sets the earliest selectable value of a date, datetime or time field.
+func FormMinDate(t time.Time) FormFieldOption {
+	return func(m map[string]any) { m["min_date"] = t.Format(time.RFC3339) }
+}
+
+// FormMaxDate sets the latest selectable value of a date, datetime or time field.
+func FormMaxDate(t time.Time) FormFieldOption {
+	return func(m map[string]any) { m["max_date"] = t.Format(time.RFC3339) }
+}
+
+// FormTimezone hints the IANA timezone a date, datetime or time field is shown in.
+func FormTimezone(tz string) FormFieldOption {
+	return func(m map[string]any) { m["timezone"] = tz }
+}
+
 type FormField struct {
 	Name         string           `json:"name"`
 	Label        string           `json:"label"`
-	Type         string           `json:"type"` // text, textarea, select, checkbox, radio, date
+	Type         string           `json:"type"` // text, textarea, select, checkbox, radio, checkbox_group, number, date, datetime, time
 	Placeholder  string           `json:"placeholder,omitempty"`
 	Required     bool             `json:"required,omitempty"`
 	DefaultValue any              `json:"default,omitempty"`
 	Options      []map[string]any `json:"options,omitempty"`
+
+	opts []FormFieldOption
 }
 
 func NewFormField(name, label, tp string) *FormField {
 	return &FormField{Name: name, Label: label, Type: tp}
 }
 
+// NewRadioGroup creates a single-choice field; add its choices with AddOption.
+func NewRadioGroup(name, label string) *FormField {
+	return NewFormField(name, label, "radio")
+}
+
+// NewCheckboxGroup creates a multi-choice field; add its choices with AddOption.
+// The selected values arrive as a list, read them with StringSlice.
+func NewCheckboxGroup(name, label string) *FormField {
+	return NewFormField(name, label, "checkbox_group")
+}
+
 func (ff *FormField) SetPlaceholder(p string) *FormField { ff.Placeholder = p; return ff }
 func (ff *FormField) SetRequired(r bool) *FormField { ff.Required = r; return ff }
 func (ff *FormField) SetDefault(d any) *FormField { ff.DefaultValue = d; return ff }
+
+// With applies options such as FormMinDate to the emitted field.
+func (ff *FormField) With(opts ...FormFieldOption) *FormField {
+	ff.opts = append(ff.opts, opts...)
+	return ff
+}
+
 func (ff *FormField) AddOption(label string, value any) *FormField {
 	ff.Options = append(ff.Options, map[string]any{"label": label, "value": value})
 	return ff
@@ -278,17 +1187,30 @@ func (ff *FormField) ToMap() map[string]any {
 	if len(ff.Options) > 0 {
 		m["options"] = ff.Options
 	}
+	for _, opt := range ff.opts {
+		opt(m)
+	}
 	return m
 }
 
 // Button (Action) template
 type Button struct {
-	Label    string `json:"label"`
-	ActionID string `json:"action_id"`
-	Type     string `json:"type,omitempty"` // primary, secondary, danger, link
-	Size     string `json:"size,omitempty"` // xs, sm, md, lg
-	Icon     string `json:"icon,omitempty"`
-	Disabled bool   `json:"disabled,omitempty"`
+	Label    string         `json:"label"`
+	ActionID string         `json:"action_id"`
+	Type     string         `json:"type,omitempty"` // primary, secondary, danger, link
+	Size     string         `json:"size,omitempty"` // xs, sm, md, lg
+	Icon     string         `json:"icon,omitempty"`
+	Disabled bool           `json:"disabled,omitempty"`
+	Loading  bool           `json:"loading,omitempty"`
+	Confirm  *ButtonConfirm `json:"confirm,omitempty"`
+}
+
+// ButtonConfirm makes the host ask for confirmation before firing the action.
+type ButtonConfirm struct {
+	Title       string `json:"title,omitempty"`
+	Message     string `json:"message"`
+	ConfirmText string `json:"confirm_text,omitempty"`
+	CancelText  string `json:"cancel_text,omitempty"`
 }
 
 func NewButton(label, actionID string) *Button {
@@ -315,6 +1237,24 @@ func (b *Button) SetDisabled(d bool) *Button {
 	return b
 }
 
+// SetLoading shows a spinner on the button and blocks clicks.
+func (b *Button) SetLoading(l bool) *Button {
+	b.Loading = l
+	return b
+}
+
+// WithConfirm prompts the agent with message before the action fires.
+func (b *Button) WithConfirm(message string) *Button {
+	b.Confirm = &ButtonConfirm{Message: message}
+	return b
+}
+
+// WithConfirmDialog prompts the agent with a fully customized confirmation dialog.
+func (b *Button) WithConfirmDialog(c ButtonConfirm) *Button {
+	b.Confirm = &c
+	return b
+}
+
 func (b *Button) ToMap() map[string]any {
 	return map[string]any{
 		"template": "button",
@@ -0,0 +1,313 @@
+package tgo_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tgoai/tgo-plugin-go"
+	"github.com/tgoai/tgo-plugin-go/tgotest"
+)
+
+func TestContainer(t *testing.T) {
+	got := tgotest.ToMap(tgo.NewContainer(tgo.NewText("hi")).SetPadding(8).SetBorder(true).SetMaxHeight(200))
+	want := map[string]any{"template": "container", "data": map[string]any{
+		"content":    map[string]any{"template": "text", "data": map[string]any{"text": "hi"}},
+		"padding":    8.0,
+		"border":     true,
+		"max_height": 200.0,
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestContainerNilContent(t *testing.T) {
+	var unset *tgo.Text
+	for _, content := range []tgo.Template{nil, tgo.When(false, tgo.NewText("hidden")), unset} {
+		got := tgotest.ToMap(tgo.NewContainer(content))
+		if data := got["data"].(map[string]any); len(data) != 0 {
+			t.Errorf("NewContainer(%#v): got data %v, want empty", content, data)
+		}
+	}
+}
+
+func TestAvatarInitials(t *testing.T) {
+	avatar := tgo.NewAvatar("ada lovelace")
+	if got := tgotest.ToMap(avatar)["data"].(map[string]any)["initials"]; got != "AL" {
+		t.Errorf("got initials %v, want AL", got)
+	}
+	if avatar.Initials != "" {
+		t.Errorf("ToMap set Initials to %q on the avatar", avatar.Initials)
+	}
+
+	avatar.Name = "张三"
+	if got := tgotest.ToMap(avatar)["data"].(map[string]any)["initials"]; got != "张" {
+		t.Errorf("after rename got initials %v, want 张", got)
+	}
+	if got := tgotest.ToMap(avatar.SetImage("https://example.com/a.png"))["data"].(map[string]any)["initials"]; got != nil {
+		t.Errorf("got initials %v with an image", got)
+	}
+}
+
+type ticket struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	internal  string
+}
+
+type audit struct {
+	Owner string `json:"owner"`
+	Title string `json:"title"` // Loses to ticket.Title
+}
+
+type auditedTicket struct {
+	ticket
+	*audit
+	Notes string `json:"-"`
+	Score int
+}
+
+func tableColumns(table *tgo.Table) []any {
+	var keys []any
+	for _, col := range table.ColumnsArr {
+		keys = append(keys, col["key"])
+	}
+	return keys
+}
+
+func TestTableFromStructs(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := []ticket{{ID: "TK-1", Title: "Login fails", Status: "Open", CreatedAt: created, internal: "x"}}
+	table := tgo.TableFromStructs("Tickets", rows)
+
+	if got, want := tableColumns(table), []any{"id", "title", "status", "created_at"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns: got %v, want %v", got, want)
+	}
+	want := []map[string]any{{"id": "TK-1", "title": "Login fails", "status": "Open", "created_at": created}}
+	if !reflect.DeepEqual(table.RowsArr, want) {
+		t.Errorf("rows: got %v, want %v", table.RowsArr, want)
+	}
+
+	table = tgo.TableFromStructs("Tickets", []*ticket{&rows[0], nil}, "status", "id")
+	if got, want := tableColumns(table), []any{"status", "id"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("selected columns: got %v, want %v", got, want)
+	}
+	want = []map[string]any{{"status": "Open", "id": "TK-1"}}
+	if !reflect.DeepEqual(table.RowsArr, want) {
+		t.Errorf("selected rows: got %v, want %v", table.RowsArr, want)
+	}
+}
+
+func TestTableFromStructsEmbedded(t *testing.T) {
+	rows := []auditedTicket{
+		{ticket: ticket{ID: "TK-1", Title: "Login fails"}, audit: &audit{Owner: "ann", Title: "hidden"}, Notes: "n", Score: 3},
+		{ticket: ticket{ID: "TK-2"}},
+	}
+	table := tgo.TableFromStructs("Tickets", rows)
+
+	if got, want := tableColumns(table), []any{"id", "title", "status", "created_at", "owner", "Score"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns: got %v, want %v", got, want)
+	}
+	if row := table.RowsArr[0]; row["title"] != "Login fails" || row["owner"] != "ann" || row["Score"] != 3 {
+		t.Errorf("row: got %v", row)
+	}
+	if _, ok := table.RowsArr[1]["owner"]; ok {
+		t.Errorf("nil embedded pointer: got %v", table.RowsArr[1])
+	}
+}
+
+func TestTableColumns(t *testing.T) {
+	table := tgo.NewTable("Orders").Columns(
+		"id",
+		tgo.Column("total", "Total", tgo.ColumnSortable(true), tgo.ColumnWidth(120), tgo.ColumnAlign("right"), tgo.ColumnType("number")),
+		tgo.Column("note", "Note"),
+		42, // Ignored
+	)
+	got := tgotest.ToMap(table)["data"].(map[string]any)["columns"]
+	want := []any{
+		map[string]any{"key": "id", "label": "id"},
+		map[string]any{"key": "total", "label": "Total", "sortable": true, "width": 120.0, "align": "right", "type": "number"},
+		map[string]any{"key": "note", "label": "Note"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestKeyValueInteractiveItems(t *testing.T) {
+	kv := tgo.NewKeyValue("Customer").
+		Add("CRM ID", "C-42", tgo.KeyValueLink("https://crm.example.com/c/42?tab=1&x=2")).
+		Add("Plan", "Pro", tgo.KeyValueAction("change_plan"), tgo.KeyValueIcon("star"))
+	kv.Group("Billing").Add("Invoice", "INV-7", tgo.KeyValueLink("https://crm.example.com/i/7"))
+
+	got := tgotest.ToMap(kv)["data"].(map[string]any)["items"]
+	want := []any{
+		map[string]any{"label": "CRM ID", "value": "C-42", "link": "https://crm.example.com/c/42?tab=1&x=2"},
+		map[string]any{"label": "Plan", "value": "Pro", "action_id": "change_plan", "icon": "star"},
+		map[string]any{"type": "group", "title": "Billing", "items": []any{
+			map[string]any{"label": "Invoice", "value": "INV-7", "link": "https://crm.example.com/i/7"},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestChoiceFields(t *testing.T) {
+	form := tgo.NewForm("Ticket").
+		Add(tgo.NewRadioGroup("priority", "Priority").AddOption("Low", "low").AddOption("High", "high").SetDefault("low")).
+		Add(tgo.NewCheckboxGroup("tags", "Tags").AddOption("Bug", "bug").AddOption("UI", "ui"))
+
+	got := tgotest.ToMap(form)["data"].(map[string]any)["fields"]
+	want := []any{
+		map[string]any{"name": "priority", "label": "Priority", "type": "radio", "required": false, "default": "low", "options": []any{
+			map[string]any{"label": "Low", "value": "low"},
+			map[string]any{"label": "High", "value": "high"},
+		}},
+		map[string]any{"name": "tags", "label": "Tags", "type": "checkbox_group", "required": false, "options": []any{
+			map[string]any{"label": "Bug", "value": "bug"},
+			map[string]any{"label": "UI", "value": "ui"},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNumberField(t *testing.T) {
+	field := tgo.NewFormField("amount", "Amount", "number").With(tgo.FormMin(0), tgo.FormMax(500), tgo.FormStep(0.01))
+	want := map[string]any{"name": "amount", "label": "Amount", "type": "number", "required": false, "min": 0.0, "max": 500.0, "step": 0.01}
+	if got := field.ToMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   func() tgo.Template
+		clone  func(tgo.Template) tgo.Template
+		mutate func(tgo.Template)
+	}{
+		{
+			name: "form",
+			base: func() tgo.Template {
+				return tgo.NewForm("Ticket").Add(tgo.NewRadioGroup("priority", "Priority").AddOption("Low", "low"))
+			},
+			clone: func(b tgo.Template) tgo.Template { return b.(*tgo.Form).Clone() },
+			mutate: func(c tgo.Template) {
+				f := c.(*tgo.Form)
+				f.Fields[0]["options"].([]map[string]any)[0]["label"] = "Niedrig"
+				f.Fields[0]["label"] = "Priorität"
+				f.Add(tgo.NewFormField("title", "Titel", "text")).SubmitAction("create_de")
+			},
+		},
+		{
+			name: "group",
+			base: func() tgo.Template {
+				return tgo.NewGroup().Add(tgo.NewText("Orders")).Add(tgo.NewTable("Recent").Columns("id").Row(map[string]any{"id": "1"}))
+			},
+			clone: func(b tgo.Template) tgo.Template { return b.(*tgo.Group).Clone() },
+			mutate: func(c tgo.Template) {
+				g := c.(*tgo.Group)
+				g.Items[1]["data"].(*tgo.Table).Row(map[string]any{"id": "2"})
+				g.Add(tgo.NewAvatar("Ann")).SetHorizontal()
+			},
+		},
+		{
+			name: "table",
+			base: func() tgo.Template {
+				return tgo.NewTable("Orders").Columns(tgo.Column("id", "ID")).Row(map[string]any{"id": "1", "open": tgo.NewButton("Open", "open")})
+			},
+			clone: func(b tgo.Template) tgo.Template { return b.(*tgo.Table).Clone() },
+			mutate: func(c tgo.Template) {
+				tb := c.(*tgo.Table)
+				tb.ColumnsArr[0]["label"] = "Nr."
+				tb.RowsArr[0]["id"] = "one"
+				tb.RowsArr[0]["open"].(map[string]any)["template"] = "text"
+				tb.Row(map[string]any{"id": "2"}).PageSize(10)
+			},
+		},
+		{
+			name: "key value",
+			base: func() tgo.Template {
+				kv := tgo.NewKeyValue("Customer").Add("Name", "Ann")
+				kv.Group("Billing").Add("Plan", "Pro")
+				return kv
+			},
+			clone: func(b tgo.Template) tgo.Template { return b.(*tgo.KeyValue).Clone() },
+			mutate: func(c tgo.Template) {
+				kv := c.(*tgo.KeyValue)
+				kv.Items[0]["value"] = "Bob"
+				kv.Items[1]["items"].([]map[string]any)[0]["value"] = "Free"
+				kv.Group("Support").Add("Tier", "1")
+			},
+		},
+		{
+			name: "tabs",
+			base: func() tgo.Template {
+				return tgo.NewTabs("info").AddTab("info", "Info", tgo.NewKeyValue("").Add("Name", "Ann"), "")
+			},
+			clone: func(b tgo.Template) tgo.Template { return b.(*tgo.Tabs).Clone() },
+			mutate: func(c tgo.Template) {
+				tabs := c.(*tgo.Tabs)
+				tabs.Items[0]["label"] = "Details"
+				tabs.Items[0]["content"].(map[string]any)["data"].(*tgo.KeyValue).Add("Plan", "Pro")
+				tabs.AddLazyTab("orders", "Orders", "load_orders", "")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := tt.base()
+			want := tgotest.ToMap(base)
+			clone := tt.clone(base)
+			if got := tgotest.ToMap(clone); !reflect.DeepEqual(got, want) {
+				t.Fatalf("clone differs: got %v, want %v", got, want)
+			}
+
+			tt.mutate(clone)
+			if got := tgotest.ToMap(base); !reflect.DeepEqual(got, want) {
+				t.Errorf("changing the clone changed the base: got %v, want %v", got, want)
+			}
+
+			changed := tgotest.ToMap(clone)
+			tt.mutate(base)
+			if got := tgotest.ToMap(clone); !reflect.DeepEqual(got, changed) {
+				t.Errorf("changing the base changed the clone: got %v, want %v", got, changed)
+			}
+		})
+	}
+}
+
+func TestTableRowAction(t *testing.T) {
+	data := tgotest.ToMap(tgo.NewTable("").RowAction("view"))["data"].(map[string]any)
+	if data["row_action_id"] != "view" || data["row_key"] != nil {
+		t.Errorf("default key: got %v", data)
+	}
+	data = tgotest.ToMap(tgo.NewTable("").RowAction("view").RowKey("ID"))["data"].(map[string]any)
+	if data["row_action_id"] != "view" || data["row_key"] != "ID" {
+		t.Errorf("custom key: got %v", data)
+	}
+}
+
+func TestTableLeavesRowsUnchanged(t *testing.T) {
+	created := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	button := tgo.NewButton("Open", "open")
+	row := map[string]any{"id": "TK-1", "created_at": created, "open": button}
+	table := tgo.NewTable("").Row(row).Rows([]map[string]any{row}).
+		Format("created_at", func(v any) any { return v.(time.Time).Format(time.DateOnly) })
+
+	want := map[string]any{"id": "TK-1", "created_at": created, "open": button}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("caller's row changed to %v", row)
+	}
+	for _, got := range table.RowsArr {
+		if got["created_at"] != "2026-01-02" || got["open"].(map[string]any)["template"] != "button" {
+			t.Errorf("got row %v", got)
+		}
+	}
+}
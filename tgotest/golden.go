@@ -0,0 +1,87 @@
+package tgotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tgoai/tgo-plugin-go"
+)
+
+// update regenerates golden files instead of comparing against them.
+// Test packages importing tgotest must not define their own -update flag.
+var update = flag.Bool("update", false, "update tgotest golden files")
+
+// AssertTemplateJSON compares the indented JSON of tmpl.ToMap() with the
+// contents of goldenPath and reports a line diff on mismatch. Run the tests
+// with -update to (re)write the golden file.
+func AssertTemplateJSON(t testing.TB, tmpl tgo.Template, goldenPath string) {
+	t.Helper()
+
+	got, err := json.MarshalIndent(tmpl.ToMap(), "", "  ")
+	if err != nil {
+		t.Fatalf("marshal template: %v", err)
+	}
+	got = append(got, '\n')
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0o755); err != nil {
+			t.Fatalf("create golden dir: %v", err)
+		}
+		if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("template does not match %s (-want +got):\n%s", goldenPath, lineDiff(string(want), string(got)))
+	}
+}
+
+// lineDiff renders a minimal line diff of a and b based on their longest common subsequence.
+func lineDiff(a, b string) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			sb.WriteString("  " + x[i] + "\n")
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("- " + x[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+ " + y[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,212 @@
+// Package tgotest provides an in-memory host for unit testing TGO plugins.
+//
+// A Harness runs the plugin with tgo.RunContext over a net.Pipe, answers the
+// registration handshake and lets tests issue requests as the host would:
+//
+//	func TestTicketPanel(t *testing.T) {
+//		h, err := tgotest.New(&TicketPlugin{})
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		defer h.Close()
+//
+//		got, err := h.RenderVisitorPanel(&tgo.RenderContext{VisitorID: "visitor_1"})
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		if got["template"] != "group" {
+//			t.Fatalf("unexpected template %v", got["template"])
+//		}
+//	}
+package tgotest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/tgoai/tgo-plugin-go"
+)
+
+// hostCompressMin is the payload size above which the harness host compresses
+// its messages once the plugin has negotiated compression.
+const hostCompressMin = 1024
+
+// HostFunc answers a request the plugin sends to the host via HostClient.
+type HostFunc func(params map[string]any) (any, error)
+
+// Harness plays the TGO host for a plugin running in the same process.
+type Harness struct {
+	host         *tgo.Transport
+	registration map[string]any
+	cancel       context.CancelFunc // Stops RunContext
+	done         chan error
+
+	mu       sync.Mutex
+	handlers map[string]HostFunc
+}
+
+// New starts p on an in-memory connection and completes registration.
+func New(p tgo.Plugin, opts ...tgo.Option) (*Harness, error) {
+	hostConn, pluginConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &Harness{
+		host:     tgo.NewConnTransport(hostConn),
+		cancel:   cancel,
+		done:     make(chan error, 1),
+		handlers: map[string]HostFunc{},
+	}
+
+	opts = append(opts, tgo.WithTransport(tgo.NewConnTransport(pluginConn)))
+	go func() {
+		err := tgo.RunContext(ctx, p, opts...)
+		// RunContext leaves the connection open if it fails before connecting.
+		pluginConn.Close()
+		h.done <- err
+	}()
+
+	if err := h.register(); err != nil {
+		if runErr := h.Close(); runErr != nil {
+			return nil, runErr
+		}
+		return nil, err
+	}
+
+	go h.host.Serve(func(msg map[string]any) { go h.handleHostCall(msg) }, nil)
+	return h, nil
+}
+
+// register answers the register request of the plugin like a host.
+func (h *Harness) register() error {
+	msg, err := h.host.RecvMessage()
+	if err != nil {
+		return fmt.Errorf("waiting for register: %w", err)
+	}
+	if msg["method"] != "register" {
+		return fmt.Errorf("expected register, got %v", msg["method"])
+	}
+	h.registration, _ = msg["params"].(map[string]any)
+	result := map[string]any{"success": true, "protocol_version": tgo.ProtocolVersion}
+	// Accept compression like a real host so it is exercised in tests.
+	if offered, _ := h.registration["compression"].([]any); slices.Contains(offered, any("gzip")) {
+		result["compression"] = "gzip"
+	}
+	if codecs, _ := h.registration["codecs"].([]any); slices.Contains(codecs, any(tgo.MsgpackCodec.Name())) {
+		result["codec"] = tgo.MsgpackCodec.Name()
+	}
+	if err := h.host.SendMessage(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      msg["id"],
+		"result":  result,
+	}); err != nil {
+		return err
+	}
+	if result["compression"] != nil {
+		h.host.SetCompression(hostCompressMin)
+	}
+	if result["codec"] != nil {
+		h.host.SetCodec(tgo.MsgpackCodec)
+	}
+	return nil
+}
+
+// Registration returns the params the plugin sent with its register request.
+func (h *Harness) Registration() map[string]any {
+	return h.registration
+}
+
+// Handle answers host method calls made by the plugin through HostClient.
+func (h *Harness) Handle(method string, fn HostFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[method] = fn
+}
+
+// Call sends a request to the plugin and returns its decoded result.
+func (h *Harness) Call(method string, params any) (map[string]any, error) {
+	return h.host.Call(method, params)
+}
+
+// RenderVisitorPanel sends a visitor_panel/render request.
+func (h *Harness) RenderVisitorPanel(ctx *tgo.RenderContext) (map[string]any, error) {
+	return h.Call("visitor_panel/render", ctx)
+}
+
+// VisitorPanelEvent sends a visitor_panel/event request.
+func (h *Harness) VisitorPanelEvent(ctx *tgo.EventContext) (map[string]any, error) {
+	return h.Call("visitor_panel/event", ctx)
+}
+
+// ExecuteTool sends a tool/execute request.
+func (h *Harness) ExecuteTool(ctx *tgo.ToolContext, toolName string, args map[string]any) (map[string]any, error) {
+	params := ToMap(ctx)
+	params["tool_name"] = toolName
+	params["arguments"] = args
+	return h.Call("tool/execute", params)
+}
+
+// Close stops the plugin and waits for RunContext to return.
+func (h *Harness) Close() error {
+	h.cancel()
+	h.host.Close()
+	err := <-h.done
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) {
+		return nil
+	}
+	return err
+}
+
+func (h *Harness) handleHostCall(msg map[string]any) {
+	method, _ := msg["method"].(string)
+	params, _ := msg["params"].(map[string]any)
+
+	h.mu.Lock()
+	fn, ok := h.handlers[method]
+	h.mu.Unlock()
+
+	resp := map[string]any{"jsonrpc": "2.0", "id": msg["id"]}
+	if !ok {
+		resp["error"] = map[string]any{"code": tgo.CodeMethodNotFound, "message": "method not found: " + method}
+	} else if result, err := fn(params); err != nil {
+		resp["error"] = map[string]any{"code": tgo.CodeServerBusy, "message": err.Error()}
+	} else {
+		resp["result"] = result
+	}
+	if _, isCall := msg["id"]; !isCall {
+		return // Notifications such as tool/progress are not answered
+	}
+	h.host.SendMessage(resp)
+}
+
+// ToMap converts v to the generic form it has on the wire. Templates and
+// actions are unwrapped through their ToMap method first.
+func ToMap(v any) map[string]any {
+	if b, ok := v.(interface{ ToMap() map[string]any }); ok {
+		v = b.ToMap()
+	}
+	data, _ := json.Marshal(v)
+	var m map[string]any
+	json.Unmarshal(data, &m)
+	if m == nil {
+		m = map[string]any{}
+	}
+	return m
+}
+
+// AssertTemplate fails t if got does not equal the wire form of want.
+func AssertTemplate(t testing.TB, got map[string]any, want tgo.Template) {
+	t.Helper()
+	w := ToMap(want)
+	if !reflect.DeepEqual(got, w) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		wantJSON, _ := json.MarshalIndent(w, "", "  ")
+		t.Errorf("template mismatch\ngot:\n%s\nwant:\n%s", gotJSON, wantJSON)
+	}
+}
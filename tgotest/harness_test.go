@@ -0,0 +1,50 @@
+package tgotest_test
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/tgoai/tgo-plugin-go"
+	"github.com/tgoai/tgo-plugin-go/tgotest"
+)
+
+type failingStart struct{ tgo.BasePlugin }
+
+func (p *failingStart) OnStart() error { return errors.New("no database") }
+
+type invalidPlugin struct{ tgo.BasePlugin }
+
+func (p *invalidPlugin) Capabilities() []tgo.Capability {
+	return []tgo.Capability{{}} // Missing type
+}
+
+func TestNewFailureDoesNotLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for _, p := range []tgo.Plugin{&failingStart{}, &invalidPlugin{}} {
+		h, err := tgotest.New(p)
+		if err == nil {
+			h.Close()
+			t.Fatalf("New(%T) succeeded", p)
+		}
+	}
+	// Let exiting goroutines finish.
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("%d goroutines leaked", n-before)
+	}
+}
+
+func TestCloseStopsPlugin(t *testing.T) {
+	h, err := tgotest.New(&tgo.BasePlugin{PID: "test", PName: "Test", PVersion: "1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
@@ -1,107 +1,551 @@
 package tgo
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// Transport handles communication with the TGO host via Unix Socket or TCP.
+// compressedFlag marks a gzip-compressed body in the high bit of the length prefix.
+const compressedFlag = 1 << 31
+
+// Transport handles communication with the TGO host via Unix Socket, TCP or WebSocket.
 type Transport struct {
 	network string
 	address string
 	conn    net.Conn
-	mu      sync.Mutex
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	mu      sync.Mutex // Held for the whole of SendMessage
+
+	// rmu guards reader, readTimeout and codec for Serve, which must not
+	// wait for mu while a SendMessage is blocked. conn changes under both.
+	rmu sync.RWMutex
+
+	compressMin     int           // Minimum body size to gzip, 0 disables compression
+	readTimeout     time.Duration // Maximum wait for each incoming frame, 0 means none
+	writeTimeout    time.Duration // Maximum time to write each outgoing frame, 0 means none
+	tlsConfig       *tls.Config   // For wss:// WebSocket transports
+	escapeHTML      bool          // Escape <, > and & in outgoing JSON
+	codec           Codec         // Body encoding, nil for JSON
+	protocolVersion atomic.Int64
+
+	nextID    int64
+	pendingMu sync.Mutex
+	pending   map[int64]chan map[string]any
+	readErr   error // Set once Serve stops reading, fails further Calls
+
+	pongMu      sync.Mutex // Guards the pong fields, see queuePong
+	pong        []byte
+	pongPending bool
+	pongWriting bool
+
+	connects      atomic.Int64
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+}
+
+// TransportStats are cumulative counters of a Transport.
+type TransportStats struct {
+	Reconnects    int64 // Successful connects after the first one
+	BytesSent     int64 // Including length prefixes
+	BytesReceived int64 // Including length prefixes
+}
+
+// Stats returns a snapshot of the transport counters.
+func (t *Transport) Stats() TransportStats {
+	return TransportStats{
+		Reconnects:    max(t.connects.Load()-1, 0),
+		BytesSent:     t.bytesSent.Load(),
+		BytesReceived: t.bytesReceived.Load(),
+	}
 }
 
 func NewUnixTransport(path string) *Transport {
-	return &Transport{network: "unix", address: path}
+	return &Transport{network: "unix", address: path, pending: map[int64]chan map[string]any{}}
 }
 
 func NewTCPTransport(addr string) *Transport {
-	return &Transport{network: "tcp", address: addr}
+	return &Transport{network: "tcp", address: addr, pending: map[int64]chan map[string]any{}}
+}
+
+// NewConnTransport wraps an already established connection, e.g. one end of net.Pipe.
+func NewConnTransport(conn net.Conn) *Transport {
+	t := &Transport{network: conn.LocalAddr().Network(), pending: map[int64]chan map[string]any{}}
+	t.setConn(conn)
+	return t
 }
 
 // Connect establishes a connection to the TGO host.
+// It is a no-op if the transport is already connected. State of a previous
+// connection is reset: the protocol version, compression and codec are
+// negotiated anew at registration and Calls no longer fail with its read
+// error.
 func (t *Transport) Connect() error {
+	if t.conn != nil {
+		return nil
+	}
+	if t.isWebSocket() {
+		conn, r, err := dialWebSocket(t.address, t.tlsConfig)
+		if err != nil {
+			return &TransportError{Op: fmt.Sprintf("connect to TGO (websocket) %s", t.address), Err: err}
+		}
+		t.setConnReader(conn, r)
+		return nil
+	}
 	conn, err := net.Dial(t.network, t.address)
 	if err != nil {
-		return fmt.Errorf("failed to connect to TGO (%s) %s: %w", t.network, t.address, err)
+		return &TransportError{Op: fmt.Sprintf("connect to TGO (%s) %s", t.network, t.address), Err: err}
 	}
-	t.conn = conn
+	t.setConn(conn)
 	return nil
 }
 
+func (t *Transport) isWebSocket() bool { return t.network == "websocket" }
+
+// SetTLSConfig sets the TLS configuration used to dial wss:// URLs.
+func (t *Transport) SetTLSConfig(cfg *tls.Config) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tlsConfig = cfg
+}
+
+// setConn installs conn together with its buffered reader and writer.
+func (t *Transport) setConn(conn net.Conn) {
+	t.setConnReader(conn, bufio.NewReader(conn))
+}
+
+// setConnReader is like setConn but keeps r, which may already hold data read from conn.
+func (t *Transport) setConnReader(conn net.Conn, r *bufio.Reader) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rmu.Lock()
+	defer t.rmu.Unlock()
+	t.connects.Add(1)
+	t.conn = conn
+	t.reader = r
+	t.writer = bufio.NewWriter(conn)
+
+	// Negotiated per connection
+	t.compressMin = 0
+	t.codec = nil
+	t.protocolVersion.Store(0)
+	t.pendingMu.Lock()
+	t.readErr = nil
+	t.pendingMu.Unlock()
+}
+
+// SetCompression makes SendMessage gzip bodies of at least minSize bytes.
+// Only enable it once the peer has agreed to compression; 0 disables it.
+// Compressed frames are always accepted when receiving.
+func (t *Transport) SetCompression(minSize int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.compressMin = minSize
+}
+
+
+// SetReadTimeout makes reads fail with a timeout TransportError when no frame
+// arrives within d, e.g. because the peer vanished without closing the
+// connection. The deadline restarts with every frame, so d must be longer
+// than the host's ping interval. 0 disables it.
+func (t *Transport) SetReadTimeout(d time.Duration) {
+	t.rmu.Lock()
+	defer t.rmu.Unlock()
+	t.readTimeout = d
+}
+
+// SetWriteTimeout makes SendMessage fail with a timeout TransportError when
+// writing a message takes longer than d, e.g. because the peer stopped
+// reading. As the message may be partly written, the connection is closed,
+// which makes Serve return so the caller can reconnect. 0 disables it.
+func (t *Transport) SetWriteTimeout(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writeTimeout = d
+}
+
+// SetEscapeHTML controls whether <, > and & in outgoing JSON strings are
+// escaped as \u003c, \u003e and \u0026 like json.Marshal does. It is off by
+// default so URLs and markup in templates reach the host unchanged.
+func (t *Transport) SetEscapeHTML(on bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.escapeHTML = on
+}
+
+// SetCodec switches the encoding of frame bodies in both directions, e.g.
+// to MsgpackCodec once the peer agreed to it. nil restores JSON.
+func (t *Transport) SetCodec(c Codec) {
+	t.rmu.Lock()
+	defer t.rmu.Unlock()
+	t.codec = c
+}
+
+// ProtocolVersion returns the protocol version negotiated at registration,
+// 0 before registration.
+func (t *Transport) ProtocolVersion() int {
+	return int(t.protocolVersion.Load())
+}
+
+// SetProtocolVersion records the negotiated protocol version.
+func (t *Transport) SetProtocolVersion(v int) {
+	t.protocolVersion.Store(int64(v))
+}
+
+// connected reports whether the transport has a connection that has not failed.
+func (t *Transport) connected() bool {
+	t.rmu.RLock()
+	conn := t.conn
+	t.rmu.RUnlock()
+	t.pendingMu.Lock()
+	defer t.pendingMu.Unlock()
+	return conn != nil && t.readErr == nil
+}
+
+// interrupt closes the connection without waiting for the write lock, so a
+// blocked SendMessage or RecvMessage fails right away. Close must still be
+// called to release the transport.
+func (t *Transport) interrupt() {
+	t.rmu.RLock()
+	conn := t.conn
+	t.rmu.RUnlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
 
 // Close closes the connection.
 func (t *Transport) Close() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	t.rmu.Lock()
+	defer t.rmu.Unlock()
 	if t.conn != nil {
 		err := t.conn.Close()
-		t.conn = nil
+		t.conn, t.reader, t.writer = nil, nil, nil
 		return err
 	}
 	return nil
 }
 
 // SendMessage sends a JSON-RPC message with a 4-byte big-endian length prefix.
-func (t *Transport) SendMessage(msg any) error {
+func (t *Transport) SendMessage(msg any) (err error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	if t.conn == nil {
-		return fmt.Errorf("not connected")
+		return ErrNotConnected
+	}
+
+	if t.writeTimeout > 0 {
+		if err := t.conn.SetWriteDeadline(time.Now().Add(t.writeTimeout)); err != nil {
+			return &TransportError{Op: "set write deadline", Err: err}
+		}
+		conn := t.conn
+		defer func() {
+			var terr *TransportError
+			if errors.As(err, &terr) && terr.Timeout() {
+				// Part of the frame may be written, the stream cannot be resumed.
+				conn.Close()
+				return
+			}
+			conn.SetWriteDeadline(time.Time{})
+		}()
 	}
 
-	data, err := json.Marshal(msg)
+	var data []byte
+	if codec := t.currentCodec(); codec != nil {
+		data, err = codec.Marshal(msg)
+	} else {
+		data, err = marshalJSON(msg, t.escapeHTML)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
-	// Write 4-byte length prefix
 	length := uint32(len(data))
-	if err := binary.Write(t.conn, binary.BigEndian, length); err != nil {
-		return fmt.Errorf("failed to write length prefix: %w", err)
+	if t.compressMin > 0 && len(data) >= t.compressMin {
+		if data, err = compress(data); err != nil {
+			return fmt.Errorf("failed to compress message: %w", err)
+		}
+		length = uint32(len(data)) | compressedFlag
+	}
+
+	// WebSocket messages carry their own length, binary ones are compressed
+	if t.isWebSocket() {
+		opcode := byte(wsText)
+		if length&compressedFlag != 0 {
+			opcode = wsBinary
+		}
+		if err := writeWebSocketFrame(t.writer, opcode, data); err != nil {
+			return &TransportError{Op: "write websocket message", Err: err}
+		}
+		if err := t.writer.Flush(); err != nil {
+			return &TransportError{Op: "flush message", Err: err}
+		}
+		t.bytesSent.Add(int64(len(data)))
+		return nil
+	}
+
+	// Write 4-byte length prefix
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], length)
+	if _, err := t.writer.Write(prefix[:]); err != nil {
+		return &TransportError{Op: "write length prefix", Err: err}
 	}
 
 	// Write JSON data
-	if _, err := t.conn.Write(data); err != nil {
-		return fmt.Errorf("failed to write message data: %w", err)
+	if _, err := t.writer.Write(data); err != nil {
+		return &TransportError{Op: "write message data", Err: err}
+	}
+
+	// Flush every complete frame so the peer never waits on a buffered message
+	if err := t.writer.Flush(); err != nil {
+		return &TransportError{Op: "flush message", Err: err}
 	}
+	t.bytesSent.Add(int64(4 + len(data)))
 
 	return nil
 }
 
 // RecvMessage receives a JSON-RPC message with a 4-byte big-endian length prefix.
 func (t *Transport) RecvMessage() (map[string]any, error) {
-	if t.conn == nil {
-		return nil, fmt.Errorf("not connected")
+	data, err := t.recvFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	var msg map[string]any
+	if err := t.unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal: %w", ErrInvalidMessage, err)
+	}
+
+	return msg, nil
+}
+
+// unmarshal decodes a frame body with the current codec.
+func (t *Transport) unmarshal(data []byte, v any) error {
+	if codec := t.currentCodec(); codec != nil {
+		return codec.Unmarshal(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (t *Transport) currentCodec() Codec {
+	t.rmu.RLock()
+	defer t.rmu.RUnlock()
+	return t.codec
+}
+
+// recvFrame reads one length-prefixed frame.
+func (t *Transport) recvFrame() ([]byte, error) {
+	t.rmu.RLock()
+	conn, reader, timeout := t.conn, t.reader, t.readTimeout
+	t.rmu.RUnlock()
+	if reader == nil {
+		return nil, ErrNotConnected
+	}
+	if timeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, &TransportError{Op: "set read deadline", Err: err}
+		}
+	}
+
+	if t.isWebSocket() {
+		data, compressed, err := t.recvWebSocketMessage(reader)
+		if err != nil {
+			return nil, &TransportError{Op: "read websocket message", Err: err}
+		}
+		if compressed {
+			return decompress(data)
+		}
+		return data, nil
 	}
 
 	// Read 4-byte length prefix
 	var length uint32
-	if err := binary.Read(t.conn, binary.BigEndian, &length); err != nil {
-		if err == io.EOF {
-			return nil, err
-		}
-		return nil, fmt.Errorf("failed to read length prefix: %w", err)
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, &TransportError{Op: "read length prefix", Err: err}
 	}
 
 	// Read JSON data
-	data := make([]byte, length)
-	if _, err := io.ReadFull(t.conn, data); err != nil {
-		return nil, fmt.Errorf("failed to read message data: %w", err)
+	data := make([]byte, length&^compressedFlag)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, &TransportError{Op: "read message data", Err: err}
 	}
+	t.bytesReceived.Add(int64(4 + len(data)))
 
-	var msg map[string]any
-	if err := json.Unmarshal(data, &msg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	if length&compressedFlag != 0 {
+		return decompress(data)
+	}
+	return data, nil
+}
+
+// marshalJSON encodes v like json.Marshal, optionally without HTML escaping.
+func marshalJSON(v any, escapeHTML bool) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(escapeHTML)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
 	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
 
-	return msg, nil
+// compress gzips a frame body.
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
+// decompress inflates a gzip-compressed frame body.
+func decompress(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decompress: %w", ErrInvalidMessage, err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decompress: %w", ErrInvalidMessage, err)
+	}
+	return out, nil
+}
+
+// Serve reads all incoming frames until the connection fails. Responses
+// matching a pending Call are routed to the waiting caller, JSON-RPC batches
+// (arrays) are passed to handleBatch and every other message to handle.
+// Batch elements that are not objects are passed as nil, to be answered as
+// invalid requests. If handleBatch is nil, batch elements are passed to
+// handle one by one and invalid ones are dropped.
+// When reading stops, pending Calls fail with the read error and Serve returns it.
+func (t *Transport) Serve(handle func(msg map[string]any), handleBatch func(batch []map[string]any)) error {
+	for {
+		data, err := t.recvFrame()
+		var body any
+		if err == nil {
+			if err = t.unmarshal(data, &body); err != nil {
+				err = fmt.Errorf("%w: failed to unmarshal: %w", ErrInvalidMessage, err)
+			}
+		}
+		if items, ok := body.([]any); ok && err == nil {
+			batch := make([]map[string]any, len(items))
+			for i, item := range items {
+				batch[i], _ = item.(map[string]any)
+			}
+			if handleBatch != nil {
+				handleBatch(batch)
+				continue
+			}
+			for _, msg := range batch {
+				if msg != nil {
+					handle(msg)
+				}
+			}
+			continue
+		}
+		msg, ok := body.(map[string]any)
+		if !ok && body != nil && err == nil {
+			err = fmt.Errorf("%w: %T is not an object", ErrInvalidMessage, body)
+		}
+		if err != nil {
+			t.failPending(err)
+			return err
+		}
+		if t.deliver(msg) {
+			continue
+		}
+		handle(msg)
+	}
+}
+
+// Call sends a JSON-RPC request to the host and waits for the matching
+// response. It requires Serve to be running to receive the response.
+func (t *Transport) Call(method string, params any) (map[string]any, error) {
+	// Plugin-initiated ids start above the id used for registration.
+	id := atomic.AddInt64(&t.nextID, 1) + registerID
+	ch := make(chan map[string]any, 1)
+
+	t.pendingMu.Lock()
+	if t.readErr != nil {
+		err := t.readErr
+		t.pendingMu.Unlock()
+		return nil, fmt.Errorf("%w: %w", ErrConnectionClosed, err)
+	}
+	t.pending[id] = ch
+	t.pendingMu.Unlock()
+	defer func() {
+		t.pendingMu.Lock()
+		delete(t.pending, id)
+		t.pendingMu.Unlock()
+	}()
+
+	if err := t.SendMessage(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	}); err != nil {
+		return nil, err
+	}
+
+	resp, ok := <-ch
+	if !ok {
+		return nil, fmt.Errorf("%w while waiting for %s: %w", ErrConnectionClosed, method, t.readErr)
+	}
+	if err := responseError(resp); err != nil {
+		return nil, err
+	}
+	result, _ := resp["result"].(map[string]any)
+	return result, nil
+}
+
+// deliver routes a response message to the pending Call waiting on its id.
+// It reports false if msg is a request or matches no pending call.
+func (t *Transport) deliver(msg map[string]any) bool {
+	if _, isRequest := msg["method"]; isRequest {
+		return false
+	}
+	idf, ok := msg["id"].(float64)
+	if !ok {
+		return false
+	}
+
+	t.pendingMu.Lock()
+	ch, ok := t.pending[int64(idf)]
+	t.pendingMu.Unlock()
+	if !ok {
+		return false
+	}
+	ch <- msg
+	return true
+}
+
+// failPending unblocks all pending Calls after the connection failed.
+func (t *Transport) failPending(err error) {
+	t.pendingMu.Lock()
+	defer t.pendingMu.Unlock()
+	t.readErr = err
+	for id, ch := range t.pending {
+		close(ch)
+		delete(t.pending, id)
+	}
+}
@@ -0,0 +1,332 @@
+package tgo_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tgoai/tgo-plugin-go"
+)
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func accept(t *testing.T, l net.Listener) *tgo.Transport {
+	t.Helper()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return tgo.NewConnTransport(conn)
+}
+
+func TestTransportReconnectResetsSession(t *testing.T) {
+	l := listen(t)
+	tr := tgo.NewTCPTransport(l.Addr().String())
+	defer tr.Close()
+
+	if err := tr.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	host := accept(t, l)
+	tr.SetProtocolVersion(tgo.ProtocolVersion)
+	tr.SetCompression(1)
+	tr.SetCodec(tgo.MsgpackCodec)
+
+	served := make(chan error, 1)
+	go func() { served <- tr.Serve(func(map[string]any) {}, nil) }()
+	host.Close()
+	if err := <-served; err == nil {
+		t.Fatal("Serve returned nil after the host closed the connection")
+	}
+	if _, err := tr.Call("ping", nil); !errors.Is(err, tgo.ErrConnectionClosed) {
+		t.Fatalf("Call on a lost connection: got %v, want ErrConnectionClosed", err)
+	}
+
+	tr.Close()
+	if err := tr.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	host = accept(t, l)
+	if v := tr.ProtocolVersion(); v != 0 {
+		t.Fatalf("protocol version %d survived the reconnect", v)
+	}
+	if n := tr.Stats().Reconnects; n != 1 {
+		t.Fatalf("got %d reconnects, want 1", n)
+	}
+
+	go tr.Serve(func(map[string]any) {}, nil)
+	go func() {
+		// A plain JSON host: it fails to decode msgpack or gzip bodies.
+		msg, err := host.RecvMessage()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": msg["id"], "result": map[string]any{"pong": true}})
+	}()
+	result, err := tr.Call("ping", nil)
+	if err != nil {
+		t.Fatalf("Call after reconnect: %v", err)
+	}
+	if result["pong"] != true {
+		t.Fatalf("unexpected result %v", result)
+	}
+}
+
+func TestRunContextReusesTransport(t *testing.T) {
+	l := listen(t)
+	tr := tgo.NewTCPTransport(l.Addr().String())
+	opts := []tgo.Option{tgo.WithTransport(tr), tgo.WithCompression(1), tgo.WithCodec(tgo.MsgpackCodec)}
+
+	// The first host agrees to msgpack and gzip, then drops the connection.
+	done := make(chan error, 1)
+	go func() { done <- tgo.RunContext(context.Background(), testPlugin(), opts...) }()
+	host := accept(t, l)
+	msg, err := host.RecvMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": msg["id"], "result": map[string]any{
+		"success": true, "protocol_version": tgo.ProtocolVersion, "compression": "gzip", "codec": "msgpack",
+	}})
+	host.Close()
+	if err := <-done; err == nil {
+		t.Fatal("RunContext returned nil after the connection was lost")
+	}
+
+	// The second registration must be plain JSON again.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- tgo.RunContext(ctx, testPlugin(), opts...) }()
+	host = accept(t, l)
+	msg, err = host.RecvMessage()
+	if err != nil {
+		t.Fatalf("decoding the second registration as JSON: %v", err)
+	}
+	if msg["method"] != "register" {
+		t.Fatalf("expected register, got %v", msg)
+	}
+	host.SendMessage(map[string]any{"jsonrpc": "2.0", "id": msg["id"], "result": map[string]any{"success": true, "protocol_version": tgo.ProtocolVersion}})
+	go host.Serve(func(map[string]any) {}, nil)
+	if _, err := host.Call("ping", nil); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunContext did not return")
+	}
+}
+
+// writeFrame writes body to conn with a length prefix carrying flags.
+func writeFrame(conn net.Conn, flags uint32, body string) {
+	binary.Write(conn, binary.BigEndian, uint32(len(body))|flags)
+	conn.Write([]byte(body))
+}
+
+func TestInvalidMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags uint32
+		body  string
+	}{
+		{"malformed json", 0, `{"jsonrpc":`},
+		{"not an object", 0, `42`},
+		{"bad gzip", 1 << 31, "not gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" recv", func(t *testing.T) {
+			a, b := net.Pipe()
+			defer a.Close()
+			tr := tgo.NewConnTransport(b)
+			defer tr.Close()
+			go writeFrame(a, tt.flags, tt.body)
+			if _, err := tr.RecvMessage(); !errors.Is(err, tgo.ErrInvalidMessage) {
+				t.Errorf("got %v, want ErrInvalidMessage", err)
+			}
+		})
+		t.Run(tt.name+" serve", func(t *testing.T) {
+			a, b := net.Pipe()
+			defer a.Close()
+			tr := tgo.NewConnTransport(b)
+			defer tr.Close()
+			go writeFrame(a, tt.flags, tt.body)
+			if err := tr.Serve(func(map[string]any) {}, nil); !errors.Is(err, tgo.ErrInvalidMessage) {
+				t.Errorf("got %v, want ErrInvalidMessage", err)
+			}
+		})
+	}
+}
+
+func TestRecvFramesSharingAWrite(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	tr := tgo.NewConnTransport(b)
+	defer tr.Close()
+
+	// Three frames in one write, as a host batching its output would send them.
+	var buf []byte
+	for _, body := range []string{`{"id":1}`, `{"id":2}`, `{"id":3}`} {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(body)))
+		buf = append(buf, body...)
+	}
+	go a.Write(buf)
+	for want := 1.0; want <= 3; want++ {
+		msg, err := tr.RecvMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg["id"] != want {
+			t.Fatalf("got %v, want id %v", msg, want)
+		}
+	}
+}
+
+func BenchmarkSmallMessages(b *testing.B) {
+	a, c := net.Pipe()
+	sender, receiver := tgo.NewConnTransport(a), tgo.NewConnTransport(c)
+	defer sender.Close()
+	defer receiver.Close()
+
+	msg := map[string]any{"jsonrpc": "2.0", "method": "ping", "id": 1}
+	b.ReportAllocs()
+	go func() {
+		for range b.N {
+			if err := sender.SendMessage(msg); err != nil {
+				return
+			}
+		}
+	}()
+	for range b.N {
+		if _, err := receiver.RecvMessage(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// readFrame reads a frame from conn and reports whether it was compressed.
+// The body is returned inflated.
+func readFrame(t *testing.T, conn net.Conn) (body []byte, compressed bool) {
+	t.Helper()
+	var length uint32
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		t.Fatal(err)
+	}
+	body = make([]byte, length&^(1<<31))
+	if _, err := io.ReadFull(conn, body); err != nil {
+		t.Fatal(err)
+	}
+	if length&(1<<31) == 0 {
+		return body, false
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body, true
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	tr := tgo.NewConnTransport(a)
+	defer tr.Close()
+	tr.SetCompression(256)
+
+	tests := []struct {
+		text       string
+		compressed bool
+	}{
+		{"small", false},
+		{strings.Repeat("large ", 100), true},
+	}
+	for _, tt := range tests {
+		msg := map[string]any{"jsonrpc": "2.0", "method": "notify", "params": map[string]any{"text": tt.text}}
+		go tr.SendMessage(msg)
+		body, compressed := readFrame(t, b)
+		if compressed != tt.compressed {
+			t.Errorf("%d byte body: compressed %v, want %v", len(body), compressed, tt.compressed)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got["params"].(map[string]any)["text"] != tt.text {
+			t.Errorf("got %v", got)
+		}
+	}
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	a, b := net.Pipe()
+	ta, tb := tgo.NewConnTransport(a), tgo.NewConnTransport(b)
+	defer ta.Close()
+	defer tb.Close()
+	ta.SetCompression(1)
+
+	rows := make([]any, 1000)
+	for i := range rows {
+		rows[i] = map[string]any{"id": float64(i), "title": "Cannot log in"}
+	}
+	want := map[string]any{"jsonrpc": "2.0", "id": 1.0, "result": map[string]any{"rows": rows}}
+	go ta.SendMessage(want)
+	got, err := tb.RecvMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("message changed in the round trip")
+	}
+	if sent := ta.Stats().BytesSent; sent > 4096 {
+		t.Errorf("sent %d bytes, compression had no effect", sent)
+	}
+}
+
+func TestEscapeHTML(t *testing.T) {
+	text := tgo.NewText(`<a href="https://crm.example.com/?id=1&tab=2">CRM</a>`)
+	for _, escape := range []bool{false, true} {
+		a, b := net.Pipe()
+		tr := tgo.NewConnTransport(a)
+		tr.SetEscapeHTML(escape)
+		go tr.SendMessage(map[string]any{"jsonrpc": "2.0", "id": 1, "result": text.ToMap()})
+		body, _ := readFrame(t, b)
+		tr.Close()
+		b.Close()
+
+		if escaped := bytes.Contains(body, []byte(`\u0026`)); escaped != escape {
+			t.Errorf("escape %v: got %s", escape, body)
+		}
+		var msg map[string]any
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if got := msg["result"].(map[string]any)["data"].(map[string]any)["text"]; got != text.Text {
+			t.Errorf("escape %v: text changed to %q", escape, got)
+		}
+	}
+}
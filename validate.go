@@ -0,0 +1,180 @@
+package tgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Manifest returns the JSON describing p as sent to the host at registration,
+// without connection specific fields such as the dev token. It fails if the
+// capabilities are invalid.
+func Manifest(p Plugin) ([]byte, error) {
+	if err := validateCapabilities(p.Capabilities()); err != nil {
+		return nil, fmt.Errorf("invalid capabilities: %w", err)
+	}
+	return json.MarshalIndent(manifest(p), "", "  ")
+}
+
+func manifest(p Plugin) map[string]any {
+	return map[string]any{
+		"id":               p.ID(),
+		"name":             p.Name(),
+		"version":          p.Version(),
+		"capabilities":     p.Capabilities(),
+		"protocol_version": ProtocolVersion,
+	}
+}
+
+// ValidateManifest checks a manifest produced by Manifest, e.g. in CI before
+// publishing a plugin, and returns all problems found joined into one error.
+func ValidateManifest(data []byte) error {
+	var m struct {
+		ID           string       `json:"id"`
+		Name         string       `json:"name"`
+		Version      string       `json:"version"`
+		Capabilities []Capability `json:"capabilities"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+	var errs []error
+	if m.ID == "" {
+		errs = append(errs, errors.New("id is required"))
+	}
+	if m.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if m.Version == "" {
+		errs = append(errs, errors.New("version is required"))
+	}
+	if len(m.Capabilities) == 0 {
+		errs = append(errs, errors.New("at least one capability is required"))
+	}
+	errs = append(errs, validateCapabilities(m.Capabilities))
+	return errors.Join(errs...)
+}
+
+// repeatableCapabilities are the capability types a plugin may declare more
+// than once, each told apart by its path, command or name. Other types,
+// including mcp_tools, which holds all tools, may appear only once.
+var repeatableCapabilities = map[string]bool{
+	"webhook":        true,
+	"slash_command":  true,
+	"scheduled_task": true,
+}
+
+// validateCapabilities checks the required fields of each capability type and
+// returns all problems found, joined into one error.
+func validateCapabilities(caps []Capability) error {
+	var errs []error
+	// Index of the first capability declaring each type, tool name and key
+	// identifying a webhook, command or task
+	types := map[string]int{}
+	toolNames := map[string]int{}
+	seen := map[string]int{}
+	unique := func(i int, where, kind, name string) {
+		if first, ok := seen[kind+":"+name]; ok {
+			errs = append(errs, fmt.Errorf("%s: duplicate %s %q, already declared by capability %d", where, kind, name, first))
+			return
+		}
+		seen[kind+":"+name] = i
+	}
+
+	for i, c := range caps {
+		where := fmt.Sprintf("capability %d (%s)", i, c.Type)
+		if first, ok := types[c.Type]; ok && c.Type != "" && !repeatableCapabilities[c.Type] {
+			errs = append(errs, fmt.Errorf("%s: duplicate capability type, already declared by capability %d", where, first))
+		} else if !ok {
+			types[c.Type] = i
+		}
+		switch c.Type {
+		case "":
+			errs = append(errs, fmt.Errorf("capability %d: type is required", i))
+		case "sidebar_iframe":
+			if c.URL == "" {
+				errs = append(errs, fmt.Errorf("%s: url is required", where))
+			}
+		case "webhook":
+			if !strings.HasPrefix(c.Path, "/") {
+				errs = append(errs, fmt.Errorf("%s: path must start with /, got %q", where, c.Path))
+			}
+			unique(i, where, "webhook path", c.Path)
+		case "slash_command":
+			if c.Command == "" {
+				errs = append(errs, fmt.Errorf("%s: command is required", where))
+			}
+			unique(i, where, "command", c.Command)
+		case "scheduled_task":
+			if c.Name == "" {
+				errs = append(errs, fmt.Errorf("%s: name is required", where))
+			}
+			unique(i, where, "task name", c.Name)
+			if len(strings.Fields(c.Cron)) != 5 {
+				errs = append(errs, fmt.Errorf("%s: cron expression must have 5 fields, got %q", where, c.Cron))
+			}
+		case "mcp_tools":
+			for _, tool := range c.Tools {
+				if tool.Name == "" {
+					errs = append(errs, fmt.Errorf("%s: tool name is required", where))
+					continue
+				}
+				if first, ok := toolNames[tool.Name]; ok {
+					errs = append(errs, fmt.Errorf("%s: duplicate tool name %q, already declared by capability %d", where, tool.Name, first))
+				} else {
+					toolNames[tool.Name] = i
+				}
+				if (tool.RateLimitN != 0 || tool.RateLimitPer != 0) && (tool.RateLimitN <= 0 || tool.RateLimitPer <= 0) {
+					errs = append(errs, fmt.Errorf("%s: tool %q has invalid rate limit %d per %s", where, tool.Name, tool.RateLimitN, tool.RateLimitPer))
+				}
+				errs = append(errs, validateToolParameters(where, tool)...)
+			}
+		}
+		if len(c.RefreshFilter) > 0 && len(c.RefreshOn) == 0 {
+			errs = append(errs, fmt.Errorf("%s: refresh filter without refresh_on events", where))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateToolParameters(where string, tool MCPToolDefinition) []error {
+	var errs []error
+	paramNames := map[string]bool{}
+	for _, p := range tool.Parameters {
+		if p.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: tool %q has a parameter without name", where, tool.Name))
+			continue
+		}
+		if paramNames[p.Name] {
+			errs = append(errs, fmt.Errorf("%s: tool %q has duplicate parameter %q", where, tool.Name, p.Name))
+		}
+		paramNames[p.Name] = true
+		switch p.Type {
+		case "string", "number", "boolean":
+		case "enum":
+			if len(p.EnumValues) == 0 {
+				errs = append(errs, fmt.Errorf("%s: enum parameter %q of tool %q has no values", where, p.Name, tool.Name))
+			}
+			for _, o := range p.EnumOptions {
+				if !slices.Contains(p.EnumValues, o.Value) {
+					errs = append(errs, fmt.Errorf("%s: enum parameter %q of tool %q has a label for unknown value %q", where, p.Name, tool.Name, o.Value))
+				}
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: parameter %q of tool %q has unknown type %q", where, p.Name, tool.Name, p.Type))
+		}
+		if p.Minimum != nil && p.Maximum != nil && *p.Minimum > *p.Maximum {
+			errs = append(errs, fmt.Errorf("%s: parameter %q of tool %q has minimum above maximum", where, p.Name, tool.Name))
+		}
+		if p.Pattern != "" {
+			if _, err := regexp.Compile(p.Pattern); err != nil {
+				errs = append(errs, fmt.Errorf("%s: parameter %q of tool %q has invalid pattern: %v", where, p.Name, tool.Name, err))
+			}
+		}
+	}
+	return errs
+}
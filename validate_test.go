@@ -0,0 +1,81 @@
+package tgo_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/tgoai/tgo-plugin-go"
+)
+
+func TestValidateManifestDuplicates(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []tgo.Capability
+		want string // Empty if valid
+	}{
+		{
+			name: "distinct",
+			caps: []tgo.Capability{
+				tgo.VisitorPanel("Panel"),
+				tgo.Webhook("/a"), tgo.Webhook("/b"),
+				tgo.ScheduledTask("sync", "0 * * * *"), tgo.ScheduledTask("cleanup", "0 0 * * *"),
+				tgo.MCPTools(tgo.Tool("lookup", "Lookup"), tgo.Tool("create", "Create")),
+			},
+		},
+		{
+			name: "capability type",
+			caps: []tgo.Capability{tgo.VisitorPanel("A"), tgo.ChatToolbar("T"), tgo.VisitorPanel("B")},
+			want: "capability 2 (visitor_panel): duplicate capability type, already declared by capability 0",
+		},
+		{
+			name: "tools capability",
+			caps: []tgo.Capability{tgo.MCPTools(tgo.Tool("a", "A")), tgo.MCPTools(tgo.Tool("b", "B"))},
+			want: "capability 1 (mcp_tools): duplicate capability type",
+		},
+		{
+			name: "tool in one capability",
+			caps: []tgo.Capability{tgo.MCPTools(tgo.Tool("lookup", "Lookup"), tgo.Tool("lookup", "Again"))},
+			want: `duplicate tool name "lookup", already declared by capability 0`,
+		},
+		{
+			name: "task name",
+			caps: []tgo.Capability{tgo.ScheduledTask("sync", "0 * * * *"), tgo.ScheduledTask("sync", "0 0 * * *")},
+			want: `capability 1 (scheduled_task): duplicate task name "sync", already declared by capability 0`,
+		},
+		{
+			name: "webhook path",
+			caps: []tgo.Capability{tgo.Webhook("/hook"), tgo.Webhook("/hook")},
+			want: `duplicate webhook path "/hook"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &tgo.BasePlugin{PID: "p", PName: "P", PVersion: "1.0.0", Caps: tt.caps}
+			// Manifest validates too, so build the manifest by hand when invalid.
+			data := []byte(`{"id":"p","name":"P","version":"1.0.0","capabilities":` + capsJSON(t, tt.caps) + `}`)
+			if tt.want == "" {
+				var err error
+				if data, err = tgo.Manifest(p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := tgo.ValidateManifest(data)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func capsJSON(t *testing.T, caps []tgo.Capability) string {
+	t.Helper()
+	data, err := json.Marshal(caps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,70 @@
+package tgo
+
+// Values is a JSON object received from the host, such as RenderContext.Context,
+// EventContext.Payload or EventContext.FormData. Its getters return the zero
+// value when a key is missing or holds another type; the OK variants report
+// whether the value was usable. Tool arguments can be read via Values(args).
+type Values map[string]any
+
+func (v Values) String(key string) string {
+	s, _ := v.StringOK(key)
+	return s
+}
+
+func (v Values) StringOK(key string) (string, bool) {
+	s, ok := v[key].(string)
+	return s, ok
+}
+
+// Int accepts integral numbers and numeric strings, see FormInt.
+func (v Values) Int(key string) int {
+	n, _ := v.IntOK(key)
+	return n
+}
+
+func (v Values) IntOK(key string) (int, bool) {
+	n, err := FormInt(v, key)
+	return n, err == nil
+}
+
+// Float accepts numbers and numeric strings, see FormFloat.
+func (v Values) Float(key string) float64 {
+	f, _ := v.FloatOK(key)
+	return f
+}
+
+func (v Values) FloatOK(key string) (float64, bool) {
+	f, err := FormFloat(v, key)
+	return f, err == nil
+}
+
+func (v Values) Bool(key string) bool {
+	b, _ := v.BoolOK(key)
+	return b
+}
+
+func (v Values) BoolOK(key string) (bool, bool) {
+	b, ok := v[key].(bool)
+	return b, ok
+}
+
+// Map returns a nested object, nil if missing.
+func (v Values) Map(key string) Values {
+	m, _ := v.MapOK(key)
+	return m
+}
+
+func (v Values) MapOK(key string) (Values, bool) {
+	switch m := v[key].(type) {
+	case map[string]any:
+		return m, true
+	case Values:
+		return m, true
+	}
+	return nil, false
+}
+
+// StringSlice returns a list of strings, see the StringSlice function.
+func (v Values) StringSlice(key string) []string {
+	return StringSlice(v, key)
+}
@@ -0,0 +1,277 @@
+package tgo
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// WebSocket opcodes, see RFC 6455 section 5.2.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsGUID is appended to the handshake key to compute Sec-WebSocket-Accept.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWebSocketMessage caps the size of an incoming message, so a malformed
+// or hostile length cannot make the reader allocate without bound.
+const maxWebSocketMessage = 64 << 20
+
+// maxWebSocketControl is the largest control frame payload, see RFC 6455 section 5.5.
+const maxWebSocketControl = 125
+
+// errWebSocketClosed is returned by reads after the host sent a close frame.
+var errWebSocketClosed = errors.New("websocket closed by peer")
+
+// NewWebSocketTransport creates a transport speaking to the host through a
+// WebSocket gateway at rawURL (ws:// or wss://). Each JSON-RPC message is one
+// WebSocket message instead of a length-prefixed frame: text for plain JSON,
+// binary for gzip-compressed JSON.
+func NewWebSocketTransport(rawURL string) *Transport {
+	return &Transport{network: "websocket", address: rawURL, pending: map[int64]chan map[string]any{}}
+}
+
+// dialWebSocket connects to rawURL and performs the opening handshake. The
+// returned reader may hold data the server sent right after the handshake.
+func dialWebSocket(rawURL string, tlsConfig *tls.Config) (net.Conn, *bufio.Reader, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	host := u.Host
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+		conn, err = net.Dial("tcp", host)
+	case "wss":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+		cfg := tlsConfig.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		conn, err = tls.Dial("tcp", host, cfg)
+	default:
+		return nil, nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, nil, fmt.Errorf("websocket handshake failed: %s", resp.Status)
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		conn.Close()
+		return nil, nil, errors.New("websocket handshake failed: invalid Sec-WebSocket-Accept")
+	}
+	return conn, r, nil
+}
+
+// writeWebSocketFrame writes one final, masked frame as required from clients.
+func writeWebSocketFrame(w io.Writer, opcode byte, payload []byte) error {
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = 0x80 | byte(n)
+	case n <= 0xFFFF:
+		header[1] = 0x80 | 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 0x80 | 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	header = append(header, mask[:]...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+	_, err := w.Write(masked)
+	return err
+}
+
+// readWebSocketFrame reads one frame and unmasks its payload if needed.
+func readWebSocketFrame(r io.Reader) (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = head[0]&0x80 != 0, head[0]&0x0F
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxWebSocketMessage || (opcode&0x08 != 0 && n > maxWebSocketControl) {
+		return false, 0, nil, fmt.Errorf("websocket frame of %d bytes exceeds the limit", n)
+	}
+	var mask [4]byte
+	masked := head[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// recvWebSocketMessage reads the next data message, reassembling fragments
+// and answering pings. It reports whether the message was binary. Replies to
+// control frames are written in the background, so a SendMessage stalled on
+// the write lock does not stop reading.
+func (t *Transport) recvWebSocketMessage(r *bufio.Reader) (data []byte, binary bool, err error) {
+	var msgOpcode byte
+	for {
+		fin, opcode, payload, err := readWebSocketFrame(r)
+		if err != nil {
+			return nil, false, err
+		}
+		t.bytesReceived.Add(int64(len(payload)))
+		switch opcode {
+		case wsPing:
+			t.queuePong(payload)
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			go t.writeWebSocketControl(wsClose, payload)
+			return nil, false, errWebSocketClosed
+		case wsText, wsBinary:
+			msgOpcode, data = opcode, payload
+		case wsContinuation:
+			if len(data)+len(payload) > maxWebSocketMessage {
+				return nil, false, fmt.Errorf("websocket message exceeds %d bytes", maxWebSocketMessage)
+			}
+			data = append(data, payload...)
+		default:
+			return nil, false, fmt.Errorf("unexpected websocket opcode %#x", opcode)
+		}
+		if fin {
+			return data, msgOpcode == wsBinary, nil
+		}
+	}
+}
+
+func (t *Transport) writeWebSocketControl(opcode byte, payload []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.writer == nil {
+		return ErrNotConnected
+	}
+	if err := writeWebSocketFrame(t.writer, opcode, payload); err != nil {
+		return err
+	}
+	return t.writer.Flush()
+}
+
+// queuePong schedules a pong answering a ping with payload. Only the latest
+// ping needs an answer, so at most one pong waits for the write lock.
+func (t *Transport) queuePong(payload []byte) {
+	t.pongMu.Lock()
+	defer t.pongMu.Unlock()
+	t.pong, t.pongPending = payload, true
+	if !t.pongWriting {
+		t.pongWriting = true
+		go t.writePongs()
+	}
+}
+
+func (t *Transport) writePongs() {
+	for {
+		t.pongMu.Lock()
+		payload, pending := t.pong, t.pongPending
+		t.pong, t.pongPending = nil, false
+		if !pending {
+			t.pongWriting = false
+		}
+		t.pongMu.Unlock()
+		if !pending {
+			return
+		}
+		// A failed write also fails the next read, which reports the error.
+		t.writeWebSocketControl(wsPong, payload)
+	}
+}
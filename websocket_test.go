@@ -0,0 +1,167 @@
+package tgo_test
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tgoai/tgo-plugin-go"
+)
+
+// wsServer accepts one WebSocket connection on l and completes the handshake.
+func wsServer(t *testing.T, l net.Listener) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	r := bufio.NewReader(conn)
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum([]byte(req.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+base64.StdEncoding.EncodeToString(sum[:])+"\r\n\r\n")
+	return conn, r
+}
+
+func connectWebSocket(t *testing.T) (*tgo.Transport, net.Conn, *bufio.Reader) {
+	t.Helper()
+	l := listen(t)
+	tr := tgo.NewWebSocketTransport("ws://" + l.Addr().String())
+	connected := make(chan error, 1)
+	go func() { connected <- tr.Connect() }()
+	conn, r := wsServer(t, l)
+	if err := <-connected; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tr.Close() })
+	return tr, conn, r
+}
+
+// wsFrame builds an unmasked server frame.
+func wsFrame(opcode byte, payload string) []byte {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 127), uint64(n))
+	}
+	return append(frame, payload...)
+}
+
+func TestWebSocketRejectsOversizedFrame(t *testing.T) {
+	for name, frame := range map[string][]byte{
+		"huge length":   binary.BigEndian.AppendUint64([]byte{0x81, 127}, 1<<62),
+		"large message": binary.BigEndian.AppendUint64([]byte{0x81, 127}, 1<<30),
+		"large ping":    wsFrame(0x9, strings.Repeat("p", 200)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			tr, conn, _ := connectWebSocket(t)
+			conn.Write(frame)
+			if _, err := tr.RecvMessage(); err == nil || !strings.Contains(err.Error(), "exceeds") {
+				t.Errorf("got %v, want a size error", err)
+			}
+		})
+	}
+}
+
+func TestWebSocketPingDoesNotWaitForWriter(t *testing.T) {
+	tr, conn, r := connectWebSocket(t)
+
+	// The server does not read, so this blocks once the socket buffers fill
+	// up, holding the write lock. It may still be marshaling when the ping
+	// arrives, in which case the pong is written first.
+	sent := make(chan error, 1)
+	go func() {
+		sent <- tr.SendMessage(map[string]any{"jsonrpc": "2.0", "method": "bulk", "params": strings.Repeat("x", 32<<20)})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	conn.Write(wsFrame(0x9, "hb"))
+	conn.Write(wsFrame(0x1, `{"jsonrpc":"2.0","method":"after_ping"}`))
+	received := make(chan map[string]any, 1)
+	go func() {
+		msg, _ := tr.RecvMessage()
+		received <- msg
+	}()
+	select {
+	case msg := <-received:
+		if msg["method"] != "after_ping" {
+			t.Fatalf("got %v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading stalled behind the blocked writer")
+	}
+
+	// Reading lets the bulk message and the pong through, in either order.
+	pong := make(chan string, 1)
+	go func() {
+		for {
+			opcode, payload, err := readClientFrame(r)
+			if err != nil {
+				return
+			}
+			if opcode == 0xA {
+				pong <- string(payload)
+			}
+		}
+	}()
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-pong:
+		if got != "hb" {
+			t.Errorf("got pong %q, want the ping payload", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no pong")
+	}
+}
+
+// readClientFrame reads one masked client frame.
+func readClientFrame(r io.Reader) (opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(r, ext[:])
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(r, ext[:])
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	var mask [4]byte
+	if err == nil {
+		_, err = io.ReadFull(r, mask[:])
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return head[0] & 0x0F, payload, nil
+}